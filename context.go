@@ -0,0 +1,91 @@
+package tinyflags
+
+import "context"
+
+const globalScope = "global"
+
+type scopeContextKey struct{}
+
+type scopeChain []string
+
+func WithScope(ctx context.Context, scope string) context.Context {
+	parent, _ := ctx.Value(scopeContextKey{}).(scopeChain)
+	chain := make(scopeChain, 0, len(parent)+1)
+	chain = append(chain, parent...)
+	chain = append(chain, scope)
+	return context.WithValue(ctx, scopeContextKey{}, chain)
+}
+
+func ScopeFromContext(ctx context.Context) string {
+	chain, _ := ctx.Value(scopeContextKey{}).(scopeChain)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] != "" {
+			return chain[i]
+		}
+	}
+	return globalScope
+}
+
+func scopeContexts(ctx context.Context) []context.Context {
+	chain, _ := ctx.Value(scopeContextKey{}).(scopeChain)
+	ctxs := make([]context.Context, 0, len(chain)+1)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] != "" && chain[i] != globalScope {
+			ctxs = append(ctxs, context.WithValue(ctx, scopeContextKey{}, chain[:i+1]))
+		}
+	}
+	return append(ctxs, context.WithValue(ctx, scopeContextKey{}, scopeChain(nil)))
+}
+
+type cacheFillContextKey struct{}
+
+func withCacheFill(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheFillContextKey{}, true)
+}
+
+func isCacheFill(ctx context.Context) bool {
+	fill, _ := ctx.Value(cacheFillContextKey{}).(bool)
+	return fill
+}
+
+type subjectContextKey struct{}
+
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectContextKey{}, subject)
+}
+
+func SubjectFromContext(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectContextKey{}).(string)
+	return subject
+}
+
+type attributesContextKey struct{}
+
+func WithAttributes(ctx context.Context, attrs map[string]string) context.Context {
+	parent, _ := ctx.Value(attributesContextKey{}).(map[string]string)
+	merged := make(map[string]string, len(parent)+len(attrs))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, attributesContextKey{}, merged)
+}
+
+func AttributeFromContext(ctx context.Context, name string) (string, bool) {
+	attrs, _ := ctx.Value(attributesContextKey{}).(map[string]string)
+	v, ok := attrs[name]
+	return v, ok
+}
+
+type actorContextKey struct{}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
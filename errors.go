@@ -0,0 +1,44 @@
+package tinyflags
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errFlightAborted = errors.New("concurrent read of the flag was aborted")
+
+type MissingFlagsError struct {
+	Keys []string
+}
+
+func (e *MissingFlagsError) Error() string {
+	return fmt.Sprintf("flags not found from any store: %s", strings.Join(e.Keys, ", "))
+}
+
+type DecodeError struct {
+	Key   string
+	Scope string
+	Store Store
+	Index int
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode flag %s in scope %s from store %T at index %d: %v", e.Key, e.Scope, e.Store, e.Index, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+type ConflictError struct {
+	Key      string
+	Scope    string
+	Expected int64
+	Actual   int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("flag %s in scope %s has version %d, expected version %d", e.Key, e.Scope, e.Actual, e.Expected)
+}
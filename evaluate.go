@@ -0,0 +1,84 @@
+package tinyflags
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+)
+
+var jsonNull = []byte("null")
+
+const maxCachedDirectives = 1024
+
+var directives = struct {
+	mu     sync.RWMutex
+	values map[string]*directive
+}{values: make(map[string]*directive)}
+
+type directive struct {
+	Rollout  *rolloutDirective  `json:"$rollout,omitempty"`
+	Rules    *rulesDirective    `json:"$rules,omitempty"`
+	Variants *variantsDirective `json:"$variants,omitempty"`
+}
+
+func resolve(ctx context.Context, k string, b []byte) ([]byte, string, error) {
+	var variant string
+	for {
+		if !maybeDirective(b) {
+			return b, variant, nil
+		}
+		d, err := parseDirective(b)
+		if err != nil {
+			return nil, "", err
+		}
+		switch {
+		case d.Rollout != nil:
+			b = d.Rollout.evaluate(ctx, k)
+		case d.Rules != nil:
+			b = d.Rules.evaluate(ctx, k)
+		case d.Variants != nil:
+			b, variant = d.Variants.evaluate(ctx, k)
+		default:
+			return b, variant, nil
+		}
+		if len(b) == 0 {
+			b = jsonNull
+		}
+	}
+}
+
+func parseDirective(b []byte) (*directive, error) {
+	directives.mu.RLock()
+	d, ok := directives.values[string(b)]
+	directives.mu.RUnlock()
+	if ok {
+		return d, nil
+	}
+	d = &directive{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, err
+	}
+	directives.mu.Lock()
+	if len(directives.values) >= maxCachedDirectives {
+		clear(directives.values)
+	}
+	directives.values[string(b)] = d
+	directives.mu.Unlock()
+	return d, nil
+}
+
+func maybeDirective(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == '{' && bytes.Contains(b, []byte(`"$`))
+}
+
+func bucket(k, subject string) float64 {
+	h := sha1.New()
+	h.Write([]byte(k))       //nolint:errcheck
+	h.Write([]byte{0})       //nolint:errcheck
+	h.Write([]byte(subject)) //nolint:errcheck
+	return float64(binary.BigEndian.Uint64(h.Sum(nil)[:8])%10000) / 100
+}
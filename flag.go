@@ -1,6 +1,7 @@
 package tinyflags
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 )
@@ -23,33 +24,85 @@ func NewInt64Flag(k string) Int64Flag     { return NewFlag[int64](k) }
 func NewIntFlag(k string) IntFlag         { return NewFlag[int](k) }
 func NewStringFlag(k string) StringFlag   { return NewFlag[string](k) }
 
+type Source int
+
+const (
+	SourceNone Source = iota
+	SourceDefault
+	SourceLocal
+	SourceStore
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceLocal:
+		return "local"
+	case SourceStore:
+		return "store"
+	default:
+		return "none"
+	}
+}
+
 type flagger interface {
 	key() string
 	emit() ([]byte, error)
-	absorb([]byte) error
+	absorb(context.Context, []byte) error
+	miss()
+	hasDefault() bool
 }
 
 type _flag struct {
 	i bool
+	d bool
 	k string
+	s Source
 }
 
 func (f _flag) key() string {
 	return f.k
 }
 
+func (f _flag) hasDefault() bool {
+	return f.d
+}
+
+func (f _flag) Found() bool {
+	return f.s == SourceStore
+}
+
+func (f _flag) Source() Source {
+	return f.s
+}
+
 type Flag[V any] struct {
 	_flag
-	v V
+	v       V
+	dv      V
+	variant string
 }
 
 func NewFlag[V any](k string) Flag[V] {
 	return Flag[V]{_flag: _flag{k: k}}
 }
 
+func (f Flag[V]) Default(v V) Flag[V] {
+	f.d = true
+	f.dv = v
+	if f.s == SourceNone || f.s == SourceDefault {
+		f.s = SourceDefault
+		f.v = v
+	}
+	return f
+}
+
 func (f Flag[V]) With(v V) Flag[V] {
 	f.i = true
+	f.s = SourceLocal
 	f.v = v
+	f.variant = ""
 	return f
 }
 
@@ -57,9 +110,15 @@ func (f *Flag[V]) Get() V {
 	return f.v
 }
 
+func (f *Flag[V]) Variant() string {
+	return f.variant
+}
+
 func (f *Flag[V]) Set(v V) {
 	f.i = true
+	f.s = SourceLocal
 	f.v = v
+	f.variant = ""
 }
 
 func (f *Flag[V]) emit() ([]byte, error) {
@@ -69,10 +128,30 @@ func (f *Flag[V]) emit() ([]byte, error) {
 	return json.Marshal(f.v)
 }
 
-func (f *Flag[V]) absorb(b []byte) error {
-	if err := json.Unmarshal(b, &f.v); err != nil {
+func (f *Flag[V]) absorb(ctx context.Context, b []byte) error {
+	b, variant, err := resolve(ctx, f.k, b)
+	if err != nil {
+		return err
+	}
+	var v V
+	if err := json.Unmarshal(b, &v); err != nil {
 		return err
 	}
 	f.i = true
+	f.s = SourceStore
+	f.v = v
+	f.variant = variant
 	return nil
 }
+
+func (f *Flag[V]) miss() {
+	var zero V
+	f.i = false
+	f.s = SourceNone
+	f.v = zero
+	f.variant = ""
+	if f.d {
+		f.s = SourceDefault
+		f.v = f.dv
+	}
+}
@@ -0,0 +1,107 @@
+package tinyflags
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type flight struct {
+	done chan struct{}
+	res  lookupResult
+	err  error
+}
+
+type flightKey struct {
+	scope string
+	key   string
+}
+
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[flightKey]*flight
+}
+
+func (m *Manager) lookupCoalesced(ctx context.Context, keys []string) ([]lookupResult, error) {
+	type call struct {
+		index int
+		id    flightKey
+		f     *flight
+	}
+	scope := ScopeFromContext(ctx)
+	var leading, waiting []call
+	m.flights.mu.Lock()
+	if m.flights.flights == nil {
+		m.flights.flights = make(map[flightKey]*flight)
+	}
+	for idx, k := range keys {
+		id := flightKey{scope, k}
+		if f, ok := m.flights.flights[id]; ok {
+			waiting = append(waiting, call{idx, id, f})
+			continue
+		}
+		f := &flight{done: make(chan struct{})}
+		m.flights.flights[id] = f
+		leading = append(leading, call{idx, id, f})
+	}
+	m.flights.mu.Unlock()
+	results := make([]lookupResult, len(keys))
+	if len(leading) > 0 {
+		current := make([]string, 0, len(leading))
+		for _, c := range leading {
+			current = append(current, keys[c.index])
+		}
+		var (
+			res []lookupResult
+			err error
+		)
+		func() {
+			defer func() {
+				m.flights.mu.Lock()
+				defer m.flights.mu.Unlock()
+				for i, c := range leading {
+					if res != nil {
+						c.f.res = res[i]
+					} else if err != nil {
+						c.f.err = err
+					} else {
+						c.f.err = errFlightAborted
+					}
+					delete(m.flights.flights, c.id)
+					close(c.f.done)
+				}
+			}()
+			res, err = m.lookup(ctx, current)
+		}()
+		if err != nil {
+			return nil, err
+		}
+		for i, c := range leading {
+			results[c.index] = res[i]
+		}
+	}
+	for _, c := range waiting {
+		select {
+		case <-c.f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.f.err != nil {
+			if !isContextError(c.f.err) || ctx.Err() != nil {
+				return nil, c.f.err
+			}
+			res, err := m.lookupCoalesced(ctx, keys[c.index:c.index+1])
+			if err != nil {
+				return nil, err
+			}
+			results[c.index] = res[0]
+			continue
+		}
+		results[c.index] = c.f.res
+	}
+	return results, nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
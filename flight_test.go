@@ -0,0 +1,79 @@
+package tinyflags
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadCoalescesConcurrentMisses(t *testing.T) {
+	store := newTestStore()
+	store.delay = 50 * time.Millisecond
+	store.values["global::x"] = []byte("true")
+	m := New(store)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := NewBoolFlag("x")
+			if err := m.Read(context.Background(), &f); err != nil {
+				t.Error(err)
+			}
+			if !f.Get() {
+				t.Error("expected true")
+			}
+		}()
+	}
+	wg.Wait()
+	if reads := store.reads.Load(); reads >= 100 {
+		t.Errorf("store was read %d times, want the reads to be coalesced", reads)
+	}
+}
+
+func TestReadSurvivesCancelledLeader(t *testing.T) {
+	store := newTestStore()
+	store.delay = 100 * time.Millisecond
+	store.values["global::x"] = []byte("true")
+	m := New(store)
+	leaderCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		f := NewBoolFlag("x")
+		leaderErr <- m.Read(leaderCtx, &f)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	f := NewBoolFlag("x")
+	if err := m.Read(context.Background(), &f); err != nil {
+		t.Fatalf("waiter failed with the leader's error: %v", err)
+	}
+	if !f.Get() {
+		t.Error("expected true")
+	}
+	if err := <-leaderErr; err == nil {
+		t.Error("expected the leader to fail with its own deadline")
+	}
+}
+
+func TestReadDoesNotCoalesceAmbiguousKeys(t *testing.T) {
+	store := newTestStore()
+	store.delay = 50 * time.Millisecond
+	m := New(store)
+	var wg sync.WaitGroup
+	for _, tt := range []struct{ scope, key string }{{"a::b", "c"}, {"a", "b::c"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := NewStringFlag(tt.key)
+			if err := m.Read(WithScope(context.Background(), tt.scope), &f); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if reads := store.reads.Load(); reads != 4 {
+		t.Errorf("store was read %d times, want 4 separate lookups", reads)
+	}
+}
@@ -0,0 +1,126 @@
+package tinyflags
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type Invalidation struct {
+	Origin    string
+	Hash      string
+	Namespace string
+	Scope     string
+	Key       string
+	Fill      bool
+	Flush     bool
+}
+
+type Invalidator interface {
+	Publish(ctx context.Context, inv Invalidation) error
+	Listen(ctx context.Context, ready func(), fn func(Invalidation)) error
+}
+
+type ResumableInvalidator interface {
+	Invalidator
+	Resumable() bool
+}
+
+type claimer interface {
+	claim() bool
+}
+
+type subscriber interface {
+	subscribe(fn func(Invalidation)) (unsubscribe func())
+}
+
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+func encodeInvalidation(inv Invalidation) (string, error) {
+	if strings.Contains(inv.Namespace, "::") || strings.Contains(inv.Scope, "::") {
+		return "", fmt.Errorf("invalidation for '%s' has a namespace or scope containing '::'", inv.Key)
+	}
+	payload := fmt.Sprintf("%s:%s:%s::%s", inv.Origin, inv.Hash, inv.Scope, inv.Key)
+	if inv.Namespace != "" {
+		payload = "@" + inv.Namespace + "::" + payload
+	}
+	if inv.Fill {
+		payload = "~" + payload
+	}
+	return payload, nil
+}
+
+func decodeInvalidation(payload string) (Invalidation, bool) {
+	var ns string
+	fill := strings.HasPrefix(payload, "~")
+	payload = strings.TrimPrefix(payload, "~")
+	if strings.HasPrefix(payload, "@") {
+		var ok bool
+		ns, payload, ok = strings.Cut(payload[1:], "::")
+		if !ok {
+			return Invalidation{}, false
+		}
+	}
+	parts := strings.SplitN(payload, ":", 3)
+	if len(parts) != 3 {
+		return Invalidation{}, false
+	}
+	scope, key, ok := strings.Cut(parts[2], "::")
+	if !ok {
+		return Invalidation{}, false
+	}
+	return Invalidation{Origin: parts[0], Hash: parts[1], Namespace: ns, Scope: scope, Key: key, Fill: fill}, true
+}
+
+func hashValue(v []byte) string {
+	h := sha1.Sum(v)
+	return hex.EncodeToString(h[:])
+}
+
+type LocalInvalidator struct {
+	mu        sync.RWMutex
+	listeners map[int]func(Invalidation)
+	nextID    int
+}
+
+func NewLocalInvalidator() *LocalInvalidator {
+	return &LocalInvalidator{listeners: make(map[int]func(Invalidation))}
+}
+
+func (i *LocalInvalidator) Publish(_ context.Context, inv Invalidation) error {
+	i.mu.RLock()
+	listeners := make([]func(Invalidation), 0, len(i.listeners))
+	for _, fn := range i.listeners {
+		listeners = append(listeners, fn)
+	}
+	i.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(inv)
+	}
+	return nil
+}
+
+func (i *LocalInvalidator) Listen(ctx context.Context, ready func(), fn func(Invalidation)) error {
+	defer i.subscribe(fn)()
+	ready()
+	<-ctx.Done()
+	return nil
+}
+
+func (i *LocalInvalidator) subscribe(fn func(Invalidation)) func() {
+	i.mu.Lock()
+	i.nextID += 1
+	id := i.nextID
+	i.listeners[id] = fn
+	i.mu.Unlock()
+	return func() {
+		i.mu.Lock()
+		delete(i.listeners, id)
+		i.mu.Unlock()
+	}
+}
@@ -0,0 +1,82 @@
+package tinyflags
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var queryNotify = `
+select pg_notify($1, $2)
+`
+
+type PostgresInvalidator struct {
+	client  *sql.DB
+	dsn     string
+	channel string
+}
+
+type postgresInvalidatorOption func(*PostgresInvalidator)
+
+func WithPostgresInvalidatorChannel(channel string) postgresInvalidatorOption {
+	return func(i *PostgresInvalidator) {
+		i.channel = channel
+	}
+}
+
+func NewPostgresInvalidator(client *sql.DB, dsn string, opts ...postgresInvalidatorOption) *PostgresInvalidator {
+	i := &PostgresInvalidator{client: client, dsn: dsn, channel: "tinyflags_invalidations"}
+	for _, apply := range opts {
+		apply(i)
+	}
+	return i
+}
+
+func (i *PostgresInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	payload, err := encodeInvalidation(inv)
+	if err != nil {
+		return err
+	}
+	_, err = i.client.ExecContext(ctx, queryNotify, i.channel, payload)
+	return err
+}
+
+func (i *PostgresInvalidator) Listen(ctx context.Context, ready func(), fn func(Invalidation)) error {
+	logger.Debugf("listening for key invalidations")
+	listener := pq.NewListener(i.dsn, 1*time.Second, 10*time.Second, nil)
+	defer listener.Close() //nolint:errcheck
+	if err := listener.Listen(i.channel); err != nil {
+		return err
+	}
+	ready()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n, ok := <-listener.Notify:
+			if !ok {
+				return errors.New("listener closed")
+			}
+			if n == nil {
+				return errors.New("listener connection was lost")
+			}
+			inv, ok := decodeInvalidation(n.Extra)
+			if !ok {
+				logger.Debugf("skipping invalidation for '%s'", n.Extra)
+				continue
+			}
+			fn(inv)
+		case <-time.After(90 * time.Second):
+			if err := listener.Ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (i *PostgresInvalidator) Ping(ctx context.Context) error {
+	return i.client.PingContext(ctx)
+}
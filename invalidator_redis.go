@@ -0,0 +1,75 @@
+package tinyflags
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisInvalidator struct {
+	client  *redis.Client
+	channel string
+}
+
+type redisInvalidatorOption func(*RedisInvalidator)
+
+func WithRedisInvalidatorChannel(channel string) redisInvalidatorOption {
+	return func(i *RedisInvalidator) {
+		i.channel = channel
+	}
+}
+
+func NewRedisInvalidator(client *redis.Client, opts ...redisInvalidatorOption) *RedisInvalidator {
+	i := &RedisInvalidator{
+		client:  client,
+		channel: strings.Join([]string{"tinyflags", "memoryStore", "invalidations"}, "::"),
+	}
+	for _, apply := range opts {
+		apply(i)
+	}
+	return i
+}
+
+func (i *RedisInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	payload, err := encodeInvalidation(inv)
+	if err != nil {
+		return err
+	}
+	return i.client.Publish(ctx, i.channel, payload).Err()
+}
+
+func (i *RedisInvalidator) Listen(ctx context.Context, ready func(), fn func(Invalidation)) error {
+	logger.Debugf("subscribing to key invalidations")
+	pubsub := i.client.Subscribe(ctx, i.channel)
+	defer pubsub.Close() //nolint:errcheck
+	if _, err := pubsub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	c := pubsub.Channel()
+	ready()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-c:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+			inv, ok := decodeInvalidation(msg.Payload)
+			if !ok {
+				logger.Debugf("skipping invalidation for '%s'", msg.Payload)
+				continue
+			}
+			fn(inv)
+		}
+	}
+}
+
+func (i *RedisInvalidator) Ping(ctx context.Context) error {
+	return i.client.Ping(ctx).Err()
+}
@@ -0,0 +1,209 @@
+package tinyflags
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisStreamInvalidator struct {
+	client    *redis.Client
+	stream    string
+	maxLen    int64
+	mu        sync.Mutex
+	claimed   bool
+	listening bool
+	lastID    string
+}
+
+type redisStreamInvalidatorOption func(*RedisStreamInvalidator)
+
+func WithRedisStreamInvalidatorStream(stream string) redisStreamInvalidatorOption {
+	return func(i *RedisStreamInvalidator) {
+		i.stream = stream
+	}
+}
+
+func WithRedisStreamInvalidatorMaxLen(n int64) redisStreamInvalidatorOption {
+	return func(i *RedisStreamInvalidator) {
+		i.maxLen = n
+	}
+}
+
+func NewRedisStreamInvalidator(client *redis.Client, opts ...redisStreamInvalidatorOption) *RedisStreamInvalidator {
+	i := &RedisStreamInvalidator{
+		client: client,
+		stream: strings.Join([]string{"tinyflags", "memoryStore", "invalidationsStream"}, "::"),
+		maxLen: 10000,
+	}
+	for _, apply := range opts {
+		apply(i)
+	}
+	return i
+}
+
+func (i *RedisStreamInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	payload, err := encodeInvalidation(inv)
+	if err != nil {
+		return err
+	}
+	return i.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: i.stream,
+		MaxLen: i.maxLen,
+		Approx: true,
+		Values: map[string]any{"payload": payload},
+	}).Err()
+}
+
+func (i *RedisStreamInvalidator) Listen(ctx context.Context, ready func(), fn func(Invalidation)) error {
+	i.mu.Lock()
+	if i.listening {
+		i.mu.Unlock()
+		return errors.New("redis stream invalidator is already in use by another listener")
+	}
+	i.listening = true
+	i.mu.Unlock()
+	defer func() {
+		i.mu.Lock()
+		i.listening = false
+		i.mu.Unlock()
+	}()
+	if err := i.resume(ctx, fn); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	ready()
+	for {
+		if err := i.read(ctx, 5*time.Second, fn); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (i *RedisStreamInvalidator) claim() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.claimed {
+		return false
+	}
+	i.claimed = true
+	return true
+}
+
+func (i *RedisStreamInvalidator) Resumable() bool {
+	return true
+}
+
+func (i *RedisStreamInvalidator) Ping(ctx context.Context) error {
+	return i.client.Ping(ctx).Err()
+}
+
+func (i *RedisStreamInvalidator) resume(ctx context.Context, fn func(Invalidation)) error {
+	info, err := i.client.XInfoStream(ctx, i.stream).Result()
+	if err != nil && !isNoSuchKey(err) {
+		return err
+	}
+	if i.lastID == "" {
+		logger.Debugf("starting to read invalidations from the end of the stream")
+		i.lastID = "0-0"
+		if err == nil && info.LastEntry.ID != "" {
+			i.lastID = info.LastEntry.ID
+		}
+		return nil
+	}
+	if err != nil || i.missed(info) {
+		logger.Debugf("missed invalidations since '%s' are no longer available, flushing", i.lastID)
+		fn(Invalidation{Flush: true})
+		i.lastID = "0-0"
+		if err == nil && info.LastEntry.ID != "" {
+			i.lastID = info.LastEntry.ID
+		}
+		return nil
+	}
+	logger.Debugf("replaying missed invalidations since '%s'", i.lastID)
+	for {
+		before := i.lastID
+		if err := i.read(ctx, -1, fn); err != nil {
+			return err
+		}
+		if i.lastID == before {
+			return nil
+		}
+	}
+}
+
+func (i *RedisStreamInvalidator) missed(info *redis.XInfoStream) bool {
+	if compareStreamIDs(info.MaxDeletedEntryID, i.lastID) > 0 {
+		return true
+	}
+	if info.FirstEntry.ID == "" {
+		return compareStreamIDs(info.LastGeneratedID, i.lastID) > 0
+	}
+	return compareStreamIDs(info.FirstEntry.ID, i.lastID) > 0
+}
+
+func (i *RedisStreamInvalidator) read(ctx context.Context, block time.Duration, fn func(Invalidation)) error {
+	streams, err := i.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{i.stream, i.lastID},
+		Count:   100,
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			i.lastID = msg.ID
+			payload, _ := msg.Values["payload"].(string)
+			inv, ok := decodeInvalidation(payload)
+			if !ok {
+				logger.Debugf("skipping invalidation for '%s'", payload)
+				continue
+			}
+			fn(inv)
+		}
+	}
+	return nil
+}
+
+func isNoSuchKey(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such key")
+}
+
+func compareStreamIDs(a, b string) int {
+	parse := func(id string) (uint64, uint64) {
+		ms, seq, _ := strings.Cut(id, "-")
+		x, _ := strconv.ParseUint(ms, 10, 64)
+		y, _ := strconv.ParseUint(seq, 10, 64)
+		return x, y
+	}
+	am, as := parse(a)
+	bm, bs := parse(b)
+	switch {
+	case am != bm:
+		if am < bm {
+			return -1
+		}
+		return 1
+	case as != bs:
+		if as < bs {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,61 @@
+package tinyflags
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCompareStreamIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1-0", "1-0", 0},
+		{"1-1", "1-0", 1},
+		{"2-0", "1-9", 1},
+		{"10-0", "9-0", 1},
+		{"", "0-0", 0},
+		{"", "1-0", -1},
+	}
+	for _, tt := range tests {
+		if got := compareStreamIDs(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareStreamIDs(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRedisStreamInvalidatorMissed(t *testing.T) {
+	tests := []struct {
+		name   string
+		lastID string
+		info   redis.XInfoStream
+		want   bool
+	}{
+		{"offset still in stream", "5-0", redis.XInfoStream{FirstEntry: redis.XMessage{ID: "3-0"}, LastGeneratedID: "9-0"}, false},
+		{"offset trimmed", "5-0", redis.XInfoStream{FirstEntry: redis.XMessage{ID: "7-0"}, LastGeneratedID: "9-0"}, true},
+		{"entries deleted after offset", "5-0", redis.XInfoStream{FirstEntry: redis.XMessage{ID: "3-0"}, MaxDeletedEntryID: "6-0", LastGeneratedID: "9-0"}, true},
+		{"stream emptied after offset", "5-0", redis.XInfoStream{LastGeneratedID: "9-0"}, true},
+		{"stream emptied at offset", "9-0", redis.XInfoStream{LastGeneratedID: "9-0"}, false},
+	}
+	for _, tt := range tests {
+		i := &RedisStreamInvalidator{lastID: tt.lastID}
+		if got := i.missed(&tt.info); got != tt.want {
+			t.Errorf("%s: missed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedisStreamInvalidatorCannotBeShared(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close() //nolint:errcheck
+	inv := NewRedisStreamInvalidator(client)
+	s := NewMemoryStore(nil, WithMemoryStoreInvalidator(inv))
+	defer s.Close() //nolint:errcheck
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic when sharing the invalidator")
+		}
+	}()
+	NewMemoryStore(nil, WithMemoryStoreInvalidator(inv))
+}
@@ -0,0 +1,65 @@
+package tinyflags
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInvalidationEncoding(t *testing.T) {
+	tests := []struct {
+		inv     Invalidation
+		payload string
+	}{
+		{Invalidation{Origin: "o", Hash: "h", Scope: "user:42", Key: "k"}, "o:h:user:42::k"},
+		{Invalidation{Hash: "h", Scope: "global", Key: "a::b"}, ":h:global::a::b"},
+		{Invalidation{Origin: "o", Hash: "h", Namespace: "my-app", Scope: "tenant:acme", Key: "k"}, "@my-app::o:h:tenant:acme::k"},
+		{Invalidation{Origin: "o", Hash: "h", Namespace: "my-app", Scope: "global", Key: "k", Fill: true}, "~@my-app::o:h:global::k"},
+	}
+	for _, tt := range tests {
+		payload, err := encodeInvalidation(tt.inv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload != tt.payload {
+			t.Errorf("encodeInvalidation(%+v) = %q, want %q", tt.inv, payload, tt.payload)
+		}
+		inv, ok := decodeInvalidation(payload)
+		if !ok || inv != tt.inv {
+			t.Errorf("decodeInvalidation(%q) = %+v, %v, want %+v", payload, inv, ok, tt.inv)
+		}
+	}
+}
+
+func TestInvalidationEncodingRejectsAmbiguousScopes(t *testing.T) {
+	for _, inv := range []Invalidation{
+		{Scope: "a::b", Key: "k"},
+		{Namespace: "a::b", Scope: "global", Key: "k"},
+	} {
+		if _, err := encodeInvalidation(inv); err == nil {
+			t.Errorf("encodeInvalidation(%+v) succeeded, want an error", inv)
+		}
+	}
+}
+
+func TestMemoryStoreNamespaces(t *testing.T) {
+	ctx := WithScope(context.Background(), "user:1")
+	inv := NewLocalInvalidator()
+	a := NewMemoryStore(nil, WithMemoryStoreNamespace("a"), WithMemoryStoreInvalidator(inv))
+	other := NewMemoryStore(nil, WithMemoryStoreNamespace("a"), WithMemoryStoreInvalidator(inv))
+	b := NewMemoryStore(nil, WithMemoryStoreNamespace("b"), WithMemoryStoreInvalidator(inv))
+	for _, s := range []*MemoryStore{a, other, b} {
+		defer s.Close() //nolint:errcheck
+		if err := s.Write(ctx, "x", []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Write(ctx, "x", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := other.Read(ctx, "x"); v != nil {
+		t.Errorf("Read() = %q, want the entry to be invalidated", v)
+	}
+	if v, _ := b.Read(ctx, "x"); string(v) != "1" {
+		t.Errorf("Read() = %q, want the other namespace to be unaffected", v)
+	}
+}
@@ -2,17 +2,81 @@ package tinyflags
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
+)
+
+type CachePolicy int
+
+const (
+	CachePolicyPopulate CachePolicy = iota
+	CachePolicyInvalidate
 )
 
 type Manager struct {
-	stores []Store
+	stores          []Store
+	authority       Store
+	cachePolicy     CachePolicy
+	strict          bool
+	transactional   bool
+	negativeCaching bool
+	mu              sync.Mutex
+	watchers        map[*watcher]struct{}
+	flights         flightGroup
+}
+
+type managerOption func(*Manager)
+
+func WithManagerStrictMode() managerOption {
+	return func(m *Manager) {
+		m.strict = true
+	}
+}
+
+func WithManagerTransactionalWrites() managerOption {
+	return func(m *Manager) {
+		m.transactional = true
+	}
+}
+
+func WithManagerNegativeCaching() managerOption {
+	return func(m *Manager) {
+		m.negativeCaching = true
+	}
+}
+
+func WithManagerAuthoritativeStore(store Store) managerOption {
+	return func(m *Manager) {
+		m.authority = store
+	}
+}
+
+func WithManagerCachePolicy(policy CachePolicy) managerOption {
+	return func(m *Manager) {
+		m.cachePolicy = policy
+	}
 }
 
 func New(stores ...Store) *Manager {
-	m := &Manager{make([]Store, 0, len(stores))}
+	m := &Manager{stores: make([]Store, 0, len(stores)), watchers: make(map[*watcher]struct{})}
 	m.stores = append(m.stores, stores...)
+	for idx, store := range m.stores {
+		if store, ok := store.(RefreshableStore); ok {
+			store.SetRefresher(func(ctx context.Context, k string) error {
+				return m.refresh(ctx, idx, k)
+			})
+		}
+	}
+	return m
+}
+
+func (m *Manager) With(opts ...managerOption) *Manager {
+	for _, apply := range opts {
+		apply(m)
+	}
 	return m
 }
 
@@ -20,74 +84,169 @@ func (m *Manager) Read(ctx context.Context, flags ...any) error {
 	if len(flags) == 0 {
 		return nil
 	}
-	flaggers := make([]flagger, 0, len(flags))
-	for _, flag := range flags {
-		v := reflect.ValueOf(flag)
-		if v.Kind() != reflect.Ptr {
-			return fmt.Errorf("flag must be a pointer to struct, got %T", flag)
-		}
-		if v.Elem().Kind() != reflect.Struct {
-			return fmt.Errorf("flag must be a pointer to struct, got pointer to %T", v.Elem().Interface())
-		}
-		if _, ok := flag.(flagger); !ok {
-			return fmt.Errorf("flag must implement flagger interface: %T", flag)
-		}
-		flaggers = append(flaggers, flag.(flagger))
+	flaggers, err := toFlaggers(flags)
+	if err != nil {
+		return err
 	}
 	remaining := make(map[int]bool)
 	for idx := range flaggers {
 		remaining[idx] = true
 	}
-	for idx, store := range m.stores {
+	for _, scopeCtx := range scopeContexts(ctx) {
 		if len(remaining) == 0 {
 			break
 		}
-		type indexed[T any] struct {
-			index int
-			value T
-		}
-		var current []indexed[flagger]
+		current := make([]int, 0, len(remaining))
 		for idx := range remaining {
-			current = append(current, indexed[flagger]{idx, flaggers[idx]})
+			current = append(current, idx)
 		}
-		for _, flag := range current {
-			b, err := store.Read(ctx, flag.value.key())
-			if err != nil {
-				return err
+		sort.Ints(current)
+		keys := make([]string, 0, len(current))
+		for _, flagIdx := range current {
+			keys = append(keys, flaggers[flagIdx].key())
+		}
+		results, err := m.lookupCoalesced(scopeCtx, keys)
+		if err != nil {
+			return err
+		}
+		for i, flagIdx := range current {
+			flag, res := flaggers[flagIdx], results[i]
+			if res.value == nil {
+				continue
 			}
-			if b != nil {
-				if err := flag.value.absorb(b); err != nil {
-					return err
-				}
-				delete(remaining, flag.index)
-				for i := idx - 1; i >= 0; i-- {
-					if err := m.stores[i].Write(ctx, flag.value.key(), b); err != nil {
-						logger.Errorf(ctx, "failed to write flag %s to store %T at index %d: %v", flag.value.key(), m.stores[i], i, err)
-					}
-				}
+			if err := flag.absorb(ctx, res.value); err != nil {
+				return &DecodeError{flag.key(), ScopeFromContext(scopeCtx), m.stores[res.index], res.index, err}
 			}
+			delete(remaining, flagIdx)
+		}
+	}
+	var missing []string
+	for idx := range remaining {
+		flaggers[idx].miss()
+		if !flaggers[idx].hasDefault() {
+			missing = append(missing, flaggers[idx].key())
 		}
 	}
+	if m.strict && len(missing) > 0 {
+		sort.Strings(missing)
+		return &MissingFlagsError{missing}
+	}
 	return nil
 }
 
-func (m *Manager) Write(ctx context.Context, flags ...any) error {
-	if len(flags) == 0 {
+type lookupResult struct {
+	value []byte
+	index int
+}
+
+func (m *Manager) lookup(ctx context.Context, keys []string) ([]lookupResult, error) {
+	results := make([]lookupResult, len(keys))
+	pending := make([]int, 0, len(keys))
+	for idx := range keys {
+		pending = append(pending, idx)
+	}
+	for idx, store := range m.stores {
+		if len(pending) == 0 {
+			break
+		}
+		current := make([]string, 0, len(pending))
+		for _, keyIdx := range pending {
+			current = append(current, keys[keyIdx])
+		}
+		values, err := m.readMany(ctx, store, current)
+		if err != nil {
+			return nil, err
+		}
+		next := make([]int, 0, len(pending))
+		for i, keyIdx := range pending {
+			b := values[i]
+			if b == nil {
+				next = append(next, keyIdx)
+				continue
+			}
+			m.writeThrough(ctx, idx, keys[keyIdx], b)
+			if !IsTombstone(b) {
+				results[keyIdx] = lookupResult{b, idx}
+			}
+		}
+		pending = next
+	}
+	if m.negativeCaching && len(pending) > 0 {
+		if idx, err := m.authoritative(); err == nil {
+			for _, keyIdx := range pending {
+				m.writeThrough(ctx, idx, keys[keyIdx], tombstone)
+			}
+		}
+	}
+	return results, nil
+}
+
+func (m *Manager) writeThrough(ctx context.Context, idx int, k string, b []byte) {
+	ctx = withCacheFill(ctx)
+	for i := idx - 1; i >= 0; i-- {
+		if err := m.stores[i].Write(ctx, k, b); err != nil {
+			logger.Errorf(ctx, "failed to write flag %s to store %T at index %d: %v", k, m.stores[i], i, err)
+		}
+	}
+}
+
+func (m *Manager) refresh(ctx context.Context, idx int, k string) error {
+	for i := idx + 1; i < len(m.stores); i++ {
+		b, err := m.stores[i].Read(ctx, k)
+		if err != nil {
+			logger.Errorf(ctx, "failed to refresh flag %s from store %T at index %d: %v", k, m.stores[i], i, err)
+			return err
+		}
+		if b != nil {
+			m.writeThrough(ctx, i, k, b)
+			return nil
+		}
+	}
+	if auth, err := m.authoritative(); err == nil && m.negativeCaching && idx < auth {
+		m.writeThrough(ctx, auth, k, tombstone)
 		return nil
 	}
-	flaggers := make([]flagger, 0, len(flags))
-	for _, flag := range flags {
-		v := reflect.ValueOf(flag)
-		if v.Kind() != reflect.Ptr {
-			return fmt.Errorf("flag must be a pointer to struct, got %T", flag)
+	m.writeThrough(ctx, idx+1, k, nil)
+	return nil
+}
+
+func (m *Manager) readScoped(ctx context.Context, k string) ([]byte, error) {
+	results, err := m.lookupCoalesced(ctx, []string{k})
+	if err != nil {
+		return nil, err
+	}
+	return results[0].value, nil
+}
+
+func (m *Manager) readMany(ctx context.Context, store Store, keys []string) ([][]byte, error) {
+	if batch, ok := store.(BatchStore); ok {
+		values, err := batch.ReadMany(ctx, keys)
+		if err != nil {
+			return nil, err
 		}
-		if v.Elem().Kind() != reflect.Struct {
-			return fmt.Errorf("flag must be a pointer to struct, got pointer to %T", v.Elem().Interface())
+		if len(values) != len(keys) {
+			return nil, fmt.Errorf("store %T returned %d values for %d keys", store, len(values), len(keys))
 		}
-		if _, ok := flag.(flagger); !ok {
-			return fmt.Errorf("flag must implement flagger interface: %T", flag)
+		return values, nil
+	}
+	values := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		b, err := store.Read(ctx, k)
+		if err != nil {
+			return nil, err
 		}
-		flaggers = append(flaggers, flag.(flagger))
+		values = append(values, b)
+	}
+	return values, nil
+}
+
+func (m *Manager) Write(ctx context.Context, flags ...any) error {
+	if len(flags) == 0 {
+		return nil
+	}
+	flaggers, err := toFlaggers(flags)
+	if err != nil {
+		return err
 	}
 	values := make([][]byte, 0, len(flaggers))
 	for _, flag := range flaggers {
@@ -97,20 +256,207 @@ func (m *Manager) Write(ctx context.Context, flags ...any) error {
 		}
 		values = append(values, b)
 	}
-	var lastErr error
+	keys := make([]string, 0, len(flaggers))
+	for _, flag := range flaggers {
+		keys = append(keys, flag.key())
+	}
+	return m.write(ctx, keys, values)
+}
+
+func (m *Manager) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return m.write(ctx, keys, make([][]byte, len(keys)))
+}
+
+func (m *Manager) ReadVersion(ctx context.Context, flag any) (int64, error) {
+	f, err := toFlagger(flag)
+	if err != nil {
+		return 0, err
+	}
+	idx, store, err := m.versionedStore()
+	if err != nil {
+		return 0, err
+	}
+	b, version, err := store.ReadVersion(ctx, f.key())
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		f.miss()
+		return version, nil
+	}
+	if err := f.absorb(ctx, b); err != nil {
+		return 0, &DecodeError{f.key(), ScopeFromContext(ctx), store, idx, err}
+	}
+	return version, nil
+}
+
+func (m *Manager) WriteVersion(ctx context.Context, flag any, version int64) (int64, error) {
+	f, err := toFlagger(flag)
+	if err != nil {
+		return 0, err
+	}
+	b, err := f.emit()
+	if err != nil {
+		return 0, err
+	}
+	idx, store, err := m.versionedStore()
+	if err != nil {
+		return 0, err
+	}
+	next, err := store.WriteVersion(ctx, f.key(), b, version)
+	if err != nil {
+		return 0, err
+	}
+	return next, m.propagate(ctx, idx, f.key(), b)
+}
+
+func (m *Manager) authoritative() (int, error) {
+	if len(m.stores) == 0 {
+		return 0, errors.New("no stores to write to")
+	}
+	if m.authority != nil {
+		for i, store := range m.stores {
+			if store == m.authority {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("authoritative store %T is not one of the stores", m.authority)
+	}
+	for i := len(m.stores) - 1; i >= 0; i-- {
+		if _, ok := m.stores[i].(TransactionalStore); ok {
+			return i, nil
+		}
+	}
+	return len(m.stores) - 1, nil
+}
+
+func (m *Manager) versionedStore() (int, VersionedStore, error) {
+	idx, err := m.authoritative()
+	if err != nil {
+		return 0, nil, err
+	}
+	store, ok := m.stores[idx].(VersionedStore)
+	if !ok {
+		return 0, nil, fmt.Errorf("authoritative store %T at index %d does not support versioned writes", m.stores[idx], idx)
+	}
+	return idx, store, nil
+}
+
+func (m *Manager) Rollback(ctx context.Context, k string, version int64) error {
 	for i := len(m.stores) - 1; i >= 0; i-- {
-		store := m.stores[i]
-		for idx, flag := range flaggers {
-			b := values[idx]
-			if err := store.Write(ctx, flag.key(), b); err != nil {
-				logger.Errorf(ctx, "failed to write flag %s to store %T at index %d: %v", flag.key(), store, i, err)
+		store, ok := m.stores[i].(HistoryStore)
+		if !ok {
+			continue
+		}
+		history, err := store.History(ctx, k)
+		if err != nil {
+			return err
+		}
+		for _, entry := range history {
+			if entry.Version == version {
+				return m.write(ctx, []string{k}, [][]byte{entry.NewValue})
+			}
+		}
+		return fmt.Errorf("version %d of flag %s not found from store %T at index %d", version, k, store, i)
+	}
+	return fmt.Errorf("no store with history to roll back flag %s", k)
+}
+
+func (m *Manager) write(ctx context.Context, keys []string, values [][]byte) error {
+	idx, err := m.authoritative()
+	if err != nil {
+		return err
+	}
+	persisted := make([]bool, len(keys))
+	var lastErr error
+	if m.transactional {
+		store, ok := m.stores[idx].(TransactionalStore)
+		if !ok {
+			return fmt.Errorf("authoritative store %T at index %d does not support transactional writes", m.stores[idx], idx)
+		}
+		if err := store.WriteMany(ctx, keys, values); err != nil {
+			return err
+		}
+		for i := range persisted {
+			persisted[i] = true
+		}
+	} else {
+		for i, k := range keys {
+			if err := m.stores[idx].Write(ctx, k, values[i]); err != nil {
+				logger.Errorf(ctx, "failed to write flag %s to store %T at index %d: %v", k, m.stores[idx], idx, err)
 				lastErr = err
+				continue
 			}
+			persisted[i] = true
+		}
+	}
+	for i, k := range keys {
+		if !persisted[i] {
+			continue
+		}
+		if err := m.propagate(ctx, idx, k, values[i]); err != nil {
+			lastErr = err
 		}
 	}
 	return lastErr
 }
 
+func (m *Manager) propagate(ctx context.Context, idx int, k string, v []byte) error {
+	cached := v
+	if m.cachePolicy == CachePolicyInvalidate {
+		cached = nil
+	}
+	var lastErr error
+	for i := idx - 1; i >= 0; i-- {
+		if err := m.stores[i].Write(ctx, k, cached); err != nil {
+			logger.Errorf(ctx, "failed to write flag %s to store %T at index %d: %v", k, m.stores[i], i, err)
+			lastErr = err
+		}
+	}
+	m.notify(ctx, k, v)
+	return lastErr
+}
+
+func (m *Manager) List(ctx context.Context) ([]Entry, error) {
+	seen := make(map[string]bool)
+	var entries []Entry
+	for _, scopeCtx := range scopeContexts(ctx) {
+		for idx, store := range m.stores {
+			store, ok := store.(ListableStore)
+			if !ok {
+				continue
+			}
+			cursor := ""
+			for {
+				page, next, err := store.List(scopeCtx, cursor, 100)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list flags from store %T at index %d: %w", store, idx, err)
+				}
+				for _, entry := range page {
+					if IsTombstone(entry.Value) {
+						continue
+					}
+					if !seen[entry.Key] {
+						seen[entry.Key] = true
+						entries = append(entries, entry)
+					}
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
 func (m *Manager) Close() error {
 	var lastErr error
 	for idx := len(m.stores) - 1; idx >= 0; idx-- {
@@ -121,3 +467,30 @@ func (m *Manager) Close() error {
 	}
 	return lastErr
 }
+
+func toFlaggers(flags []any) ([]flagger, error) {
+	flaggers := make([]flagger, 0, len(flags))
+	for _, flag := range flags {
+		f, err := toFlagger(flag)
+		if err != nil {
+			return nil, err
+		}
+		flaggers = append(flaggers, f)
+	}
+	return flaggers, nil
+}
+
+func toFlagger(flag any) (flagger, error) {
+	v := reflect.ValueOf(flag)
+	if v.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("flag must be a pointer to struct, got %T", flag)
+	}
+	if v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("flag must be a pointer to struct, got pointer to %T", v.Elem().Interface())
+	}
+	f, ok := flag.(flagger)
+	if !ok {
+		return nil, fmt.Errorf("flag must implement flagger interface: %T", flag)
+	}
+	return f, nil
+}
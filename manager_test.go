@@ -0,0 +1,214 @@
+package tinyflags
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReadScopeFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		scopes []string
+		want   string
+		source string
+	}{
+		{"global only", map[string]string{"global::x": "1"}, []string{"tenant:acme", "user:42"}, "1", "global"},
+		{"tenant overrides global", map[string]string{"global::x": "1", "tenant:acme::x": "2"}, []string{"tenant:acme", "user:42"}, "2", "tenant:acme"},
+		{"user overrides tenant", map[string]string{"global::x": "1", "tenant:acme::x": "2", "user:42::x": "3"}, []string{"tenant:acme", "user:42"}, "3", "user:42"},
+		{"unrelated scope is ignored", map[string]string{"global::x": "1", "user:7::x": "3"}, []string{"tenant:acme", "user:42"}, "1", "global"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore()
+			for k, v := range tt.values {
+				store.values[k] = []byte(v)
+			}
+			mem := NewMemoryStore(nil)
+			defer mem.Close() //nolint:errcheck
+			m := New(mem, store)
+			ctx := context.Background()
+			for _, scope := range tt.scopes {
+				ctx = WithScope(ctx, scope)
+			}
+			f := NewIntFlag("x")
+			if err := m.Read(ctx, &f); err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Get(); got != int(tt.want[0]-'0') {
+				t.Fatalf("Read() = %d, want %s", got, tt.want)
+			}
+			for _, scope := range append([]string{globalScope}, tt.scopes...) {
+				b, _ := mem.Read(WithScope(context.Background(), scope), "x")
+				if scope == tt.source && string(b) != tt.want {
+					t.Errorf("memory store has %q in scope %s, want %q", b, scope, tt.want)
+				}
+				if scope != tt.source && b != nil {
+					t.Errorf("memory store has %q in scope %s, want nothing", b, scope)
+				}
+			}
+		})
+	}
+}
+
+func TestReadNegativeCaching(t *testing.T) {
+	store := newTestStore()
+	store.values["global::x"] = []byte("1")
+	mem := NewMemoryStore(nil)
+	defer mem.Close() //nolint:errcheck
+	m := New(mem, store).With(WithManagerNegativeCaching())
+	ctx := WithScope(context.Background(), "user:42")
+	for i := 0; i < 3; i++ {
+		x, y := NewIntFlag("x"), NewIntFlag("y")
+		if err := m.Read(ctx, &x, &y); err != nil {
+			t.Fatal(err)
+		}
+		if x.Get() != 1 || y.Found() {
+			t.Fatalf("Read() = %d, %v, want 1 and a missing y", x.Get(), y.Found())
+		}
+	}
+	if reads := store.reads.Load(); reads != 4 {
+		t.Errorf("store was read %d times, want 4 for the first read only", reads)
+	}
+	tests := []struct {
+		scope     string
+		key       string
+		tombstone bool
+	}{
+		{"user:42", "x", true},
+		{"user:42", "y", true},
+		{globalScope, "x", false},
+		{globalScope, "y", true},
+	}
+	for _, tt := range tests {
+		b, _ := mem.Read(WithScope(context.Background(), tt.scope), tt.key)
+		if IsTombstone(b) != tt.tombstone {
+			t.Errorf("memory store has %q for %s in scope %s, want tombstone %v", b, tt.key, tt.scope, tt.tombstone)
+		}
+	}
+	y := NewIntFlag("y").With(5)
+	if err := m.Write(context.Background(), &y); err != nil {
+		t.Fatal(err)
+	}
+	y = NewIntFlag("y")
+	if err := m.Read(ctx, &y); err != nil {
+		t.Fatal(err)
+	}
+	if y.Get() != 5 {
+		t.Errorf("Read() = %d after a write, want 5", y.Get())
+	}
+}
+
+func TestRefreshWritesTombstones(t *testing.T) {
+	tests := []struct {
+		name            string
+		negativeCaching bool
+		tombstone       bool
+	}{
+		{"with negative caching", true, true},
+		{"without negative caching", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore()
+			store.values["global::x"] = []byte("1")
+			mem := NewMemoryStore(nil)
+			defer mem.Close() //nolint:errcheck
+			m := New(mem, store)
+			if tt.negativeCaching {
+				m.With(WithManagerNegativeCaching())
+			}
+			f := NewIntFlag("x")
+			if err := m.Read(context.Background(), &f); err != nil {
+				t.Fatal(err)
+			}
+			delete(store.values, "global::x")
+			m.refresh(context.Background(), 0, "x")
+			b, _ := mem.Read(context.Background(), "x")
+			if IsTombstone(b) != tt.tombstone || (!tt.tombstone && b != nil) {
+				t.Errorf("memory store has %q after refresh, want tombstone %v", b, tt.tombstone)
+			}
+		})
+	}
+}
+
+func TestAuthoritativeStore(t *testing.T) {
+	mem, a, b := NewMemoryStore(nil), newTestStore(), newTestStore()
+	defer mem.Close() //nolint:errcheck
+	tests := []struct {
+		name string
+		opts []managerOption
+		want int
+	}{
+		{"last store by default", nil, 2},
+		{"explicit store", []managerOption{WithManagerAuthoritativeStore(a)}, 1},
+	}
+	for _, tt := range tests {
+		idx, err := New(mem, a, b).With(tt.opts...).authoritative()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx != tt.want {
+			t.Errorf("%s: authoritative() = %d, want %d", tt.name, idx, tt.want)
+		}
+	}
+	if _, err := New(mem, a).With(WithManagerAuthoritativeStore(b)).authoritative(); err == nil {
+		t.Error("expected an error for a store outside the chain")
+	}
+}
+
+func TestWriteCachePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy CachePolicy
+		cached string
+	}{
+		{"populate", CachePolicyPopulate, "2"},
+		{"invalidate", CachePolicyInvalidate, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore()
+			store.values["global::x"] = []byte("1")
+			mem := NewMemoryStore(nil)
+			defer mem.Close() //nolint:errcheck
+			m := New(mem, store).With(WithManagerCachePolicy(tt.policy))
+			f := NewIntFlag("x")
+			if err := m.Read(context.Background(), &f); err != nil {
+				t.Fatal(err)
+			}
+			f = NewIntFlag("x").With(2)
+			if err := m.Write(context.Background(), &f); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(store.values["global::x"]); got != "2" {
+				t.Errorf("authoritative store has %q, want %q", got, "2")
+			}
+			if b, _ := mem.Read(context.Background(), "x"); string(b) != tt.cached {
+				t.Errorf("memory store has %q, want %q", b, tt.cached)
+			}
+		})
+	}
+}
+
+func TestWriteLeavesCachesOnAuthoritativeFailure(t *testing.T) {
+	store := newTestStore()
+	store.values["global::x"] = []byte("1")
+	mem := NewMemoryStore(nil)
+	defer mem.Close() //nolint:errcheck
+	m := New(mem, store)
+	f := NewIntFlag("x")
+	if err := m.Read(context.Background(), &f); err != nil {
+		t.Fatal(err)
+	}
+	errWrite := errors.New("write failed")
+	store.fail(errWrite)
+	f = NewIntFlag("x").With(2)
+	if err := m.Write(context.Background(), &f); !errors.Is(err, errWrite) {
+		t.Fatalf("Write() = %v, want %v", err, errWrite)
+	}
+	if b, _ := mem.Read(context.Background(), "x"); string(b) != "1" {
+		t.Errorf("memory store has %q, want the old value %q", b, "1")
+	}
+}
@@ -0,0 +1,42 @@
+package tinyflags
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type Rollout[V any] struct {
+	Percentage float64
+	Value      V
+	Otherwise  V
+}
+
+func NewRollout[V any](percentage float64, value, otherwise V) Rollout[V] {
+	return Rollout[V]{percentage, value, otherwise}
+}
+
+func (r Rollout[V]) MarshalJSON() ([]byte, error) {
+	value, err := json.Marshal(r.Value)
+	if err != nil {
+		return nil, err
+	}
+	otherwise, err := json.Marshal(r.Otherwise)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(directive{Rollout: &rolloutDirective{r.Percentage, value, otherwise}})
+}
+
+type rolloutDirective struct {
+	Percentage float64         `json:"percentage"`
+	Value      json.RawMessage `json:"value"`
+	Otherwise  json.RawMessage `json:"otherwise"`
+}
+
+func (d *rolloutDirective) evaluate(ctx context.Context, k string) json.RawMessage {
+	subject := SubjectFromContext(ctx)
+	if subject == "" || bucket(k, subject) >= d.Percentage {
+		return d.Otherwise
+	}
+	return d.Value
+}
@@ -0,0 +1,187 @@
+package tinyflags
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+)
+
+type Operator string
+
+const (
+	OperatorEq    Operator = "=="
+	OperatorNeq   Operator = "!="
+	OperatorIn    Operator = "in"
+	OperatorNotIn Operator = "not_in"
+	OperatorGt    Operator = ">"
+	OperatorGte   Operator = ">="
+	OperatorLt    Operator = "<"
+	OperatorLte   Operator = "<="
+)
+
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  Operator `json:"operator"`
+	Value     string   `json:"value,omitempty"`
+	Values    []string `json:"values,omitempty"`
+}
+
+type Attribute string
+
+func (a Attribute) Eq(v string) Condition       { return Condition{string(a), OperatorEq, v, nil} }
+func (a Attribute) Neq(v string) Condition      { return Condition{string(a), OperatorNeq, v, nil} }
+func (a Attribute) In(v ...string) Condition    { return Condition{string(a), OperatorIn, "", v} }
+func (a Attribute) NotIn(v ...string) Condition { return Condition{string(a), OperatorNotIn, "", v} }
+func (a Attribute) Gt(v string) Condition       { return Condition{string(a), OperatorGt, v, nil} }
+func (a Attribute) Gte(v string) Condition      { return Condition{string(a), OperatorGte, v, nil} }
+func (a Attribute) Lt(v string) Condition       { return Condition{string(a), OperatorLt, v, nil} }
+func (a Attribute) Lte(v string) Condition      { return Condition{string(a), OperatorLte, v, nil} }
+
+func (c Condition) matches(ctx context.Context) bool {
+	v, ok := AttributeFromContext(ctx, c.Attribute)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case OperatorEq:
+		return v == c.Value
+	case OperatorNeq:
+		return v != c.Value
+	case OperatorIn:
+		return slices.Contains(c.Values, v)
+	case OperatorNotIn:
+		return !slices.Contains(c.Values, v)
+	case OperatorGt:
+		return compareVersions(v, c.Value) > 0
+	case OperatorGte:
+		return compareVersions(v, c.Value) >= 0
+	case OperatorLt:
+		return compareVersions(v, c.Value) < 0
+	case OperatorLte:
+		return compareVersions(v, c.Value) <= 0
+	default:
+		return false
+	}
+}
+
+type Rule[V any] struct {
+	Conditions []Condition
+	Value      V
+}
+
+func NewRule[V any](value V, conditions ...Condition) Rule[V] {
+	return Rule[V]{conditions, value}
+}
+
+type Rules[V any] struct {
+	Rules   []Rule[V]
+	Default V
+}
+
+func NewRules[V any](fallback V, rules ...Rule[V]) Rules[V] {
+	return Rules[V]{rules, fallback}
+}
+
+func (r Rules[V]) MarshalJSON() ([]byte, error) {
+	d := &rulesDirective{Rules: make([]ruleDirective, 0, len(r.Rules))}
+	for _, rule := range r.Rules {
+		value, err := json.Marshal(rule.Value)
+		if err != nil {
+			return nil, err
+		}
+		d.Rules = append(d.Rules, ruleDirective{rule.Conditions, value})
+	}
+	fallback, err := json.Marshal(r.Default)
+	if err != nil {
+		return nil, err
+	}
+	d.Default = fallback
+	return json.Marshal(directive{Rules: d})
+}
+
+type ruleDirective struct {
+	Conditions []Condition     `json:"conditions"`
+	Value      json.RawMessage `json:"value"`
+}
+
+type rulesDirective struct {
+	Rules   []ruleDirective `json:"rules"`
+	Default json.RawMessage `json:"default"`
+}
+
+func (d *rulesDirective) evaluate(ctx context.Context, _ string) json.RawMessage {
+	for _, rule := range d.Rules {
+		matched := true
+		for _, c := range rule.Conditions {
+			if !c.matches(ctx) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule.Value
+		}
+	}
+	return d.Default
+}
+
+func compareVersions(a, b string) int {
+	for a != "" || b != "" {
+		var x, y string
+		x, a = nextVersionPart(a)
+		y, b = nextVersionPart(b)
+		if c := compareVersionParts(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func nextVersionPart(v string) (string, string) {
+	for i := 0; i < len(v); i++ {
+		if v[i] == '.' {
+			return v[:i], v[i+1:]
+		}
+	}
+	return v, ""
+}
+
+func compareVersionParts(a, b string) int {
+	if a == "" {
+		a = "0"
+	}
+	if b == "" {
+		b = "0"
+	}
+	if isDigits(a) && isDigits(b) {
+		for len(a) > 1 && a[0] == '0' {
+			a = a[1:]
+		}
+		for len(b) > 1 && b[0] == '0' {
+			b = b[1:]
+		}
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
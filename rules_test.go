@@ -0,0 +1,118 @@
+package tinyflags
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3.2", "3.2", 0},
+		{"3.2", "3.2.0", 0},
+		{"", "0", 0},
+		{"03.2", "3.02", 0},
+		{"3.10", "3.2", 1},
+		{"3.2", "3.10", -1},
+		{"4", "3.99.99", 1},
+		{"3.2.1", "3.2", 1},
+		{"10.0", "9.9", 1},
+		{"1.0.beta", "1.0.alpha", 1},
+		{"1.0.a", "1.0.1", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestConditionMatches(t *testing.T) {
+	ctx := WithAttributes(context.Background(), map[string]string{
+		"country":     "FI",
+		"plan":        "enterprise",
+		"app_version": "3.10.1",
+	})
+	tests := []struct {
+		name string
+		c    Condition
+		want bool
+	}{
+		{"eq", Attribute("plan").Eq("enterprise"), true},
+		{"eq mismatch", Attribute("plan").Eq("free"), false},
+		{"neq", Attribute("plan").Neq("free"), true},
+		{"neq mismatch", Attribute("plan").Neq("enterprise"), false},
+		{"in", Attribute("country").In("FI", "SE"), true},
+		{"in mismatch", Attribute("country").In("NO", "DK"), false},
+		{"not in", Attribute("country").NotIn("NO", "DK"), true},
+		{"not in mismatch", Attribute("country").NotIn("FI"), false},
+		{"gt", Attribute("app_version").Gt("3.2"), true},
+		{"gt equal", Attribute("app_version").Gt("3.10.1"), false},
+		{"gte", Attribute("app_version").Gte("3.10.1"), true},
+		{"gte mismatch", Attribute("app_version").Gte("4"), false},
+		{"lt", Attribute("app_version").Lt("4.0"), true},
+		{"lt mismatch", Attribute("app_version").Lt("3.2"), false},
+		{"lte", Attribute("app_version").Lte("3.10.1"), true},
+		{"lte mismatch", Attribute("app_version").Lte("3.10"), false},
+		{"missing attribute", Attribute("region").Neq("eu"), false},
+		{"unknown operator", Condition{Attribute: "plan", Operator: "~", Value: "enterprise"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.c.matches(ctx); got != tt.want {
+			t.Errorf("%s: matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRulesResolve(t *testing.T) {
+	b, err := json.Marshal(NewRules("free",
+		NewRule("nordic", Attribute("country").In("FI", "SE"), Attribute("app_version").Gte("3.2")),
+		NewRule("enterprise", Attribute("plan").Eq("enterprise")),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		attrs map[string]string
+		want  string
+	}{
+		{map[string]string{"country": "FI", "app_version": "3.2"}, `"nordic"`},
+		{map[string]string{"country": "FI", "app_version": "3.1", "plan": "enterprise"}, `"enterprise"`},
+		{map[string]string{"country": "DK"}, `"free"`},
+		{nil, `"free"`},
+	}
+	for _, tt := range tests {
+		got, _, err := resolve(WithAttributes(context.Background(), tt.attrs), "k", b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("resolve(%v) = %s, want %s", tt.attrs, got, tt.want)
+		}
+	}
+}
+
+func TestRulesResolveAllocations(t *testing.T) {
+	b, err := json.Marshal(NewRules(false,
+		NewRule(true, Attribute("country").In("FI", "SE"), Attribute("app_version").Gte("3.2")),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithAttributes(context.Background(), map[string]string{"country": "FI", "app_version": "3.2"})
+	if _, _, err := resolve(ctx, "k", b); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		resolve(ctx, "k", b) //nolint:errcheck
+	})
+	if allocs != 0 {
+		t.Errorf("resolve allocated %v times per run, want 0", allocs)
+	}
+}
@@ -1,9 +1,68 @@
 package tinyflags
 
-import "context"
+import (
+	"bytes"
+	"context"
+	"time"
+)
 
 type Store interface {
 	Read(ctx context.Context, k string) ([]byte, error)
 	Write(ctx context.Context, k string, v []byte) error
 	Close() error
 }
+
+var tombstone = []byte("\x00tinyflags:absent")
+
+func IsTombstone(b []byte) bool {
+	return bytes.Equal(b, tombstone)
+}
+
+type BatchStore interface {
+	Store
+	ReadMany(ctx context.Context, keys []string) ([][]byte, error)
+}
+
+type Entry struct {
+	Key   string
+	Scope string
+	Value []byte
+}
+
+type ListableStore interface {
+	Store
+	List(ctx context.Context, cursor string, limit int) ([]Entry, string, error)
+}
+
+type RefreshableStore interface {
+	Store
+	SetRefresher(fn func(ctx context.Context, k string) error)
+}
+
+type TransactionalStore interface {
+	Store
+	WriteMany(ctx context.Context, keys []string, values [][]byte) error
+}
+
+const anyVersion int64 = -1
+
+type VersionedStore interface {
+	Store
+	ReadVersion(ctx context.Context, k string) ([]byte, int64, error)
+	WriteVersion(ctx context.Context, k string, v []byte, version int64) (int64, error)
+}
+
+type HistoryStore interface {
+	Store
+	History(ctx context.Context, k string) ([]HistoryEntry, error)
+}
+
+type HistoryEntry struct {
+	Version   int64
+	CreatedAt time.Time
+	Scope     string
+	Key       string
+	OldValue  []byte
+	NewValue  []byte
+	Actor     string
+}
@@ -3,6 +3,7 @@ package tinyflags
 import (
 	"context"
 	"encoding/json"
+	"sort"
 	"sync"
 )
 
@@ -26,12 +27,40 @@ func (s *ConstantStore) With(k string, v any) *ConstantStore {
 	return s
 }
 
-func (s *ConstantStore) Read(_ context.Context, k string) ([]byte, error) {
+func (s *ConstantStore) Read(ctx context.Context, k string) ([]byte, error) {
+	if ScopeFromContext(ctx) != globalScope {
+		return nil, nil
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.values[k], nil
 }
 
+func (s *ConstantStore) List(ctx context.Context, cursor string, limit int) ([]Entry, string, error) {
+	if ScopeFromContext(ctx) != globalScope {
+		return nil, "", nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		if k > cursor {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	next := ""
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[len(keys)-1]
+	}
+	entries := make([]Entry, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, Entry{k, globalScope, s.values[k]})
+	}
+	return entries, next, nil
+}
+
 func (s *ConstantStore) Write(_ context.Context, k string, v []byte) error {
 	return nil
 }
@@ -3,35 +3,77 @@ package tinyflags
 import (
 	"context"
 	crand "crypto/rand"
-	"crypto/sha1"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	mrand "math/rand"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type memoryStoreValue struct {
-	value   []byte
-	hash    string
-	expires time.Time
+	value      []byte
+	hash       string
+	created    time.Time
+	expires    time.Time
+	refreshing bool
+	retryAt    time.Time
+	accessed   atomic.Int64
+	hits       atomic.Uint64
+}
+
+const refreshRetryDelay = 1 * time.Second
+
+type EvictionPolicy int
+
+const (
+	EvictionLRU EvictionPolicy = iota
+	EvictionLFU
+)
+
+type MemoryStoreState int
+
+const (
+	MemoryStoreStarting MemoryStoreState = iota
+	MemoryStoreActive
+	MemoryStoreDisconnected
+	MemoryStoreClosed
+)
+
+type MemoryStoreStats struct {
+	Entries   int
+	Bytes     int
+	Evictions uint64
 }
 
 type MemoryStore struct {
 	id        string
-	client    *redis.Client
-	pubsub    *redis.PubSub
+	ns        string
+	inv       Invalidator
 	mu        sync.RWMutex
 	ttl       time.Duration
-	values    map[string]memoryStoreValue
+	negTTL    time.Duration
+	stale     time.Duration
+	degraded  time.Duration
+	refresher func(context.Context, string) error
+	onState   func(MemoryStoreState)
+	values    map[string]*memoryStoreValue
+	size      int
+	maxSize   int
+	maxLen    int
+	policy    EvictionPolicy
+	evictions atomic.Uint64
 	isActive  bool
 	isClosed  bool
+	wasActive bool
+	downSince time.Time
 	closeOnce sync.Once
 	done      chan struct{}
+	watchers  map[int]func(context.Context, string)
+	watcherID int
 }
 
 type memoryStoreOption func(*MemoryStore)
@@ -42,6 +84,60 @@ func WithMemoryStoreTTL(ttl time.Duration) memoryStoreOption {
 	}
 }
 
+func WithMemoryStoreNegativeTTL(ttl time.Duration) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.negTTL = ttl
+	}
+}
+
+func WithMemoryStoreStaleWhileRevalidate(stale time.Duration) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.stale = stale
+	}
+}
+
+func WithMemoryStoreDegradedTTL(ttl time.Duration) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.degraded = ttl
+	}
+}
+
+func WithMemoryStoreStateChange(fn func(MemoryStoreState)) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.onState = fn
+	}
+}
+
+func WithMemoryStoreMaxEntries(n int) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.maxLen = n
+	}
+}
+
+func WithMemoryStoreMaxBytes(n int) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.maxSize = n
+	}
+}
+
+func WithMemoryStoreEvictionPolicy(policy EvictionPolicy) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.policy = policy
+	}
+}
+
+func WithMemoryStoreNamespace(ns string) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.ns = ns
+	}
+}
+
+func WithMemoryStoreInvalidator(inv Invalidator) memoryStoreOption {
+	return func(s *MemoryStore) {
+		s.inv = inv
+	}
+}
+
 func NewMemoryStore(client *redis.Client, opts ...memoryStoreOption) *MemoryStore {
 	b := make([]byte, 16)
 	if _, err := crand.Read(b); err != nil {
@@ -49,19 +145,26 @@ func NewMemoryStore(client *redis.Client, opts ...memoryStoreOption) *MemoryStor
 	}
 	s := &MemoryStore{
 		id:        hex.EncodeToString(b),
-		client:    client,
-		pubsub:    nil,
 		mu:        sync.RWMutex{},
 		ttl:       1 * time.Minute,
-		values:    make(map[string]memoryStoreValue),
+		negTTL:    10 * time.Second,
+		values:    make(map[string]*memoryStoreValue),
 		isActive:  false,
 		isClosed:  false,
+		downSince: time.Now(),
 		closeOnce: sync.Once{},
 		done:      make(chan struct{}),
+		watchers:  make(map[int]func(context.Context, string)),
 	}
 	for _, apply := range opts {
 		apply(s)
 	}
+	if s.inv == nil {
+		s.inv = s.defaultInvalidator(client)
+	}
+	if c, ok := s.inv.(claimer); ok && !c.claim() {
+		panic(fmt.Sprintf("invalidator %T is already used by another memory store", s.inv))
+	}
 	s.listen()
 	s.cleanup()
 	return s
@@ -69,152 +172,300 @@ func NewMemoryStore(client *redis.Client, opts ...memoryStoreOption) *MemoryStor
 
 func (s *MemoryStore) Read(ctx context.Context, k string) ([]byte, error) {
 	s.mu.RLock()
-	if s.isClosed || !s.isActive {
+	if s.isClosed || (!s.isActive && s.degraded <= 0) {
 		s.mu.RUnlock()
 		return nil, nil
 	}
-	k = s.getKey(k)
-	if v, ok := s.values[k]; ok {
-		if v.expires.Before(time.Now()) {
-			s.mu.RUnlock()
-			s.mu.Lock()
-			delete(s.values, k)
-			s.mu.Unlock()
+	key := s.getKey(ctx, k)
+	v, ok := s.values[key]
+	isActive, downSince := s.isActive, s.downSince
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	now := time.Now()
+	if !isActive {
+		since := v.created
+		if since.Before(downSince) {
+			since = downSince
+		}
+		if v.expires.Before(now) || !now.Before(since.Add(s.degraded)) {
 			return nil, nil
 		}
-		s.mu.RUnlock()
+		v.touch(now)
 		return v.value, nil
 	}
-	s.mu.RUnlock()
+	if !v.expires.Before(now) {
+		v.touch(now)
+		return v.value, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok = s.values[key]
+	if !ok {
+		return nil, nil
+	}
+	if !v.expires.Before(now) {
+		v.touch(now)
+		return v.value, nil
+	}
+	if s.refresher != nil && now.Before(v.expires.Add(s.stale)) {
+		if !v.refreshing && !now.Before(v.retryAt) {
+			logger.Debugf("refreshing stale '%s'", key)
+			v.refreshing = true
+			go s.refresh(WithScope(context.Background(), ScopeFromContext(ctx)), s.refresher, k, key, v)
+		}
+		v.touch(now)
+		return v.value, nil
+	}
+	s.remove(key)
 	return nil, nil
 }
 
-func (s *MemoryStore) Write(ctx context.Context, k string, v []byte) error {
+func (s *MemoryStore) refresh(ctx context.Context, fn func(context.Context, string) error, k, key string, v *memoryStoreValue) {
+	err := fn(ctx, k)
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.isClosed || !s.isActive {
+	if s.values[key] != v {
+		return
+	}
+	v.refreshing = false
+	if err != nil {
+		v.retryAt = time.Now().Add(refreshRetryDelay)
+	}
+}
+
+func (s *MemoryStore) SetRefresher(fn func(ctx context.Context, k string) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresher = fn
+}
+
+func (s *MemoryStore) Write(ctx context.Context, k string, v []byte) error {
+	scope := ScopeFromContext(ctx)
+	if strings.Contains(scope, "::") {
+		logger.Debugf("not caching '%s' in scope '%s' that can't be invalidated", k, scope)
+		return nil
+	}
+	s.mu.Lock()
+	if s.isClosed || (!s.isActive && s.degraded <= 0) {
+		s.mu.Unlock()
 		return nil
 	}
-	k = s.getKey(k)
 	if v == nil {
-		delete(s.values, k)
-		s.triggerInvalidation("", k)
+		s.remove(s.getKey(ctx, k))
+		s.mu.Unlock()
+		s.triggerInvalidation(ctx, "", scope, k)
 		return nil
 	}
-	h := sha1.New()
-	if _, err := h.Write(v); err != nil {
-		return err
+	hash := hashValue(v)
+	ttl := s.ttl
+	if IsTombstone(v) {
+		if s.negTTL <= 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		ttl = s.negTTL
+	}
+	if !s.isActive && s.degraded < ttl {
+		ttl = s.degraded
 	}
-	hash := hex.EncodeToString(h.Sum(nil))
-	s.values[k] = memoryStoreValue{v, hash, time.Now().Add(s.ttl)}
-	s.triggerInvalidation(hash, k)
+	s.set(s.getKey(ctx, k), v, hash, ttl)
+	s.mu.Unlock()
+	s.triggerInvalidation(ctx, hash, scope, k)
 	return nil
 }
 
+func (s *MemoryStore) Watch(ctx context.Context, fn func(ctx context.Context, k string)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watcherID += 1
+	id := s.watcherID
+	s.watchers[id] = fn
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		s.mu.Lock()
+		delete(s.watchers, id)
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+func (s *MemoryStore) State() MemoryStoreState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case s.isClosed:
+		return MemoryStoreClosed
+	case s.isActive:
+		return MemoryStoreActive
+	case !s.wasActive:
+		return MemoryStoreStarting
+	default:
+		return MemoryStoreDisconnected
+	}
+}
+
+func (s *MemoryStore) Stats() MemoryStoreStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return MemoryStoreStats{len(s.values), s.size, s.evictions.Load()}
+}
+
 func (s *MemoryStore) Close() error {
-	var err error
 	s.closeOnce.Do(func() {
 		s.mu.Lock()
-		defer s.mu.Unlock()
-		if !s.isClosed {
-			logger.Debugf("closing memory store")
-			close(s.done)
-			s.isClosed = true
-		}
-		if s.pubsub != nil {
-			logger.Debugf("closing an active pubsub connection")
-			err = s.pubsub.Close()
-		}
+		logger.Debugf("closing memory store")
+		close(s.done)
+		s.isClosed = true
+		s.mu.Unlock()
+		s.changeState(MemoryStoreClosed)
 	})
-	return err
+	return nil
 }
 
-func (s *MemoryStore) getKey(k string) string {
-	return strings.Join([]string{"global", k}, "::")
+func (s *MemoryStore) getKey(ctx context.Context, k string) string {
+	return s.scopedKey(ScopeFromContext(ctx), k)
 }
-func (s *MemoryStore) getInvalidationsChannel() string {
-	return strings.Join([]string{"tinyflags", "memoryStore", "invalidations"}, "::")
+
+func (s *MemoryStore) scopedKey(scope, k string) string {
+	return strings.Join([]string{s.ns, scope, k}, "::")
 }
 
-func (s *MemoryStore) triggerInvalidation(hash, key string) {
-	ctx := context.Background()
-	err := s.client.Publish(ctx, s.getInvalidationsChannel(), fmt.Sprintf("%s:%s:%s", s.id, hash, key)).Err()
-	if err != nil {
-		logger.Errorf(ctx, "failed to invalidate '%s': %v", key, err)
+func (s *MemoryStore) defaultInvalidator(client *redis.Client) Invalidator {
+	if client == nil {
+		return NewLocalInvalidator()
+	}
+	if s.ns == "" {
+		return NewRedisInvalidator(client)
+	}
+	channel := strings.Join([]string{"tinyflags", "memoryStore", s.ns, "invalidations"}, "::")
+	return NewRedisInvalidator(client, WithRedisInvalidatorChannel(channel))
+}
+
+func (s *MemoryStore) triggerInvalidation(ctx context.Context, hash, scope, k string) {
+	inv := Invalidation{Origin: s.id, Hash: hash, Namespace: s.ns, Scope: scope, Key: k, Fill: isCacheFill(ctx)}
+	ctx = context.Background()
+	if err := s.inv.Publish(ctx, inv); err != nil {
+		logger.Errorf(ctx, "failed to invalidate '%s': %v", s.scopedKey(scope, k), err)
 	}
 }
 
 func (s *MemoryStore) listen() {
-	ctx := context.Background()
+	if sub, ok := s.inv.(subscriber); ok {
+		unsubscribe := sub.subscribe(s.invalidate)
+		s.activate()
+		go func() {
+			<-s.done
+			unsubscribe()
+		}()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
 	go func() {
+		defer cancel()
+		go func() {
+			<-s.done
+			cancel()
+		}()
 		for {
-			err := s.subscribe()
-			s.mu.Lock()
-			s.isActive = false
-			s.values = make(map[string]memoryStoreValue)
-			s.mu.Unlock()
-			if err == nil {
-				logger.Debugf("subscribe returned without an error")
+			err := s.inv.Listen(ctx, s.activate, s.invalidate)
+			s.deactivate()
+			if err == nil || ctx.Err() != nil {
+				logger.Debugf("listening for invalidations returned without an error")
 				return
 			}
-			if err := s.client.Ping(ctx).Err(); err != nil {
-				logger.Errorf(ctx, "redis client ping returned an error, retrying in ~10s: %v", err)
-				delay, jitter := 10000, 2000
-				time.Sleep(time.Duration(delay-(jitter/2)+r.Intn(jitter)) * time.Millisecond)
+			var delay, jitter int
+			if p, ok := s.inv.(pinger); ok && p.Ping(ctx) != nil {
+				logger.Errorf(ctx, "invalidator ping returned an error, retrying in ~10s: %v", err)
+				delay, jitter = 10000, 2000
 			} else {
 				logger.Errorf(ctx, "listening for invalidations returned an error, retrying in ~1s: %v", err)
-				delay, jitter := 1000, 500
-				time.Sleep(time.Duration(delay-(jitter/2)+r.Intn(jitter)) * time.Millisecond)
+				delay, jitter = 1000, 500
+			}
+			select {
+			case <-s.done:
+				return
+			case <-time.After(time.Duration(delay-(jitter/2)+r.Intn(jitter)) * time.Millisecond):
 			}
 		}
 	}()
 }
 
-func (s *MemoryStore) subscribe() error {
-	select {
-	case <-s.done:
-		return nil
-	default:
+func (s *MemoryStore) activate() {
+	s.mu.Lock()
+	if s.isClosed || s.isActive {
+		s.mu.Unlock()
+		return
+	}
+	s.isActive = true
+	s.wasActive = true
+	if !s.resumable() {
+		s.flush()
 	}
-	logger.Debugf("subscribing to key invalidations")
-	ctx := context.Background()
+	s.mu.Unlock()
+	s.changeState(MemoryStoreActive)
+}
+
+func (s *MemoryStore) deactivate() {
 	s.mu.Lock()
-	if s.pubsub != nil {
-		logger.Debugf("closing an existing pubsub connection")
-		s.pubsub.Close() //nolint:errcheck
+	if s.isClosed || !s.isActive {
+		s.mu.Unlock()
+		return
+	}
+	s.isActive = false
+	s.downSince = time.Now()
+	if s.degraded <= 0 && !s.resumable() {
+		s.flush()
 	}
-	s.pubsub = s.client.Subscribe(ctx, s.getInvalidationsChannel())
 	s.mu.Unlock()
-	if _, err := s.pubsub.Receive(ctx); err != nil {
-		return err
+	s.changeState(MemoryStoreDisconnected)
+}
+
+func (s *MemoryStore) resumable() bool {
+	inv, ok := s.inv.(ResumableInvalidator)
+	return ok && inv.Resumable()
+}
+
+func (s *MemoryStore) changeState(state MemoryStoreState) {
+	if s.onState != nil {
+		s.onState(state)
 	}
-	c := s.pubsub.Channel()
+}
+
+func (s *MemoryStore) invalidate(inv Invalidation) {
+	if inv.Flush {
+		logger.Debugf("flushing all entries")
+		s.mu.Lock()
+		s.flush()
+		s.mu.Unlock()
+		return
+	}
+	if inv.Origin == s.id || inv.Namespace != s.ns {
+		return
+	}
+	key := s.scopedKey(inv.Scope, inv.Key)
 	s.mu.Lock()
-	s.isActive = true
+	v, ok := s.values[key]
+	if ok && v.hash != inv.Hash {
+		logger.Debugf("invalidating '%s'", key)
+		s.remove(key)
+	}
+	if inv.Fill || (ok && v.hash == inv.Hash) {
+		s.mu.Unlock()
+		return
+	}
+	watchers := make([]func(context.Context, string), 0, len(s.watchers))
+	for _, fn := range s.watchers {
+		watchers = append(watchers, fn)
+	}
 	s.mu.Unlock()
-	for {
-		select {
-		case <-s.done:
-			s.pubsub.Close() //nolint:errcheck
-			return nil
-		case msg, ok := <-c:
-			if !ok {
-				return errors.New("subscription closed")
-			}
-			parts := strings.SplitN(msg.Payload, ":", 3)
-			if len(parts) != 3 || parts[0] == s.id {
-				logger.Debugf("skipping invalidation for '%s'", msg.Payload)
-				continue
-			}
-			s.mu.Lock()
-			hash, key := parts[1], parts[2]
-			if v, ok := s.values[key]; ok && v.hash != hash {
-				logger.Debugf("invalidating '%s'", key)
-				delete(s.values, key)
-			}
-			s.mu.Unlock()
-		}
+	for _, fn := range watchers {
+		fn(WithScope(context.Background(), inv.Scope), inv.Key)
 	}
 }
 
@@ -234,8 +485,8 @@ func (s *MemoryStore) cleanup() {
 				}
 				now := time.Now()
 				for k, v := range s.values {
-					if v.expires.Before(now) {
-						delete(s.values, k)
+					if v.expires.Add(s.stale).Before(now) {
+						s.remove(k)
 					}
 				}
 				s.mu.Unlock()
@@ -243,3 +494,89 @@ func (s *MemoryStore) cleanup() {
 		}
 	}()
 }
+
+func (v *memoryStoreValue) touch(now time.Time) {
+	v.accessed.Store(now.UnixNano())
+	v.hits.Add(1)
+}
+
+func (s *MemoryStore) set(k string, b []byte, hash string, ttl time.Duration) {
+	now := time.Now()
+	v := &memoryStoreValue{value: b, hash: hash, created: now, expires: now.Add(ttl)}
+	v.accessed.Store(now.UnixNano())
+	if old, ok := s.values[k]; ok {
+		v.hits.Store(old.hits.Load())
+		s.remove(k)
+	}
+	s.values[k] = v
+	s.size += len(k) + len(b)
+	for (s.maxLen > 0 && len(s.values) > s.maxLen) || (s.maxSize > 0 && s.size > s.maxSize) {
+		if !s.evict(k, now) {
+			break
+		}
+	}
+}
+
+func (s *MemoryStore) flush() {
+	s.values = make(map[string]*memoryStoreValue)
+	s.size = 0
+}
+
+func (s *MemoryStore) remove(k string) {
+	if v, ok := s.values[k]; ok {
+		s.size -= len(k) + len(v.value)
+		delete(s.values, k)
+	}
+}
+
+func (s *MemoryStore) evict(protect string, now time.Time) bool {
+	const samples = 8
+	var (
+		victim string
+		found  bool
+		best   memoryStoreEvictionScore
+	)
+	n := 0
+	for k, v := range s.values {
+		if k == protect {
+			continue
+		}
+		score := s.score(v, now)
+		if !found || score.less(best) {
+			victim, best, found = k, score, true
+		}
+		if n++; n >= samples {
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	logger.Debugf("evicting '%s'", victim)
+	s.remove(victim)
+	s.evictions.Add(1)
+	return true
+}
+
+type memoryStoreEvictionScore struct {
+	expired bool
+	value   int64
+}
+
+func (a memoryStoreEvictionScore) less(b memoryStoreEvictionScore) bool {
+	if a.expired != b.expired {
+		return a.expired
+	}
+	return a.value < b.value
+}
+
+func (s *MemoryStore) score(v *memoryStoreValue, now time.Time) memoryStoreEvictionScore {
+	score := memoryStoreEvictionScore{expired: v.expires.Before(now)}
+	switch s.policy {
+	case EvictionLFU:
+		score.value = int64(v.hits.Load())
+	default:
+		score.value = v.accessed.Load()
+	}
+	return score
+}
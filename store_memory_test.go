@@ -0,0 +1,406 @@
+package tinyflags
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreIsReadyWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 1000; i++ {
+		s := NewMemoryStore(nil)
+		if err := s.Write(ctx, "x", []byte("true")); err != nil {
+			t.Fatal(err)
+		}
+		b, err := s.Read(ctx, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "true" {
+			t.Fatalf("iteration %d: Read() = %q, want %q", i, b, "true")
+		}
+		s.Close() //nolint:errcheck
+	}
+}
+
+func TestMemoryStoreSharedLocalInvalidator(t *testing.T) {
+	ctx := context.Background()
+	inv := NewLocalInvalidator()
+	a := NewMemoryStore(nil, WithMemoryStoreInvalidator(inv))
+	b := NewMemoryStore(nil, WithMemoryStoreInvalidator(inv))
+	defer a.Close() //nolint:errcheck
+	defer b.Close() //nolint:errcheck
+	if err := b.Write(ctx, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Write(ctx, "x", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := b.Read(ctx, "x"); v != nil {
+		t.Errorf("Read() = %q, want the entry to be invalidated", v)
+	}
+	if v, _ := a.Read(ctx, "x"); string(v) != "2" {
+		t.Errorf("Read() = %q, want %q", v, "2")
+	}
+}
+
+func TestMemoryStoreStaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(nil, WithMemoryStoreTTL(20*time.Millisecond), WithMemoryStoreStaleWhileRevalidate(time.Hour))
+	defer s.Close() //nolint:errcheck
+	calls := make(chan string, 16)
+	release := make(chan struct{})
+	s.SetRefresher(func(_ context.Context, k string) error {
+		calls <- k
+		<-release
+		return s.Write(ctx, k, []byte("2"))
+	})
+	if err := s.Write(ctx, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if b, _ := s.Read(ctx, "x"); string(b) != "1" {
+			t.Fatalf("Read() = %q, want the stale value %q", b, "1")
+		}
+	}
+	<-calls
+	close(release)
+	waitFor(t, func() bool {
+		b, _ := s.Read(ctx, "x")
+		return string(b) == "2"
+	})
+	if n := len(calls); n != 0 {
+		t.Errorf("refresher was called %d more times, want a single refresh", n)
+	}
+}
+
+func TestMemoryStoreRetriesFailedRefresh(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(nil, WithMemoryStoreTTL(20*time.Millisecond), WithMemoryStoreStaleWhileRevalidate(time.Hour))
+	defer s.Close() //nolint:errcheck
+	var calls atomic.Int64
+	s.SetRefresher(func(context.Context, string) error {
+		calls.Add(1)
+		return errors.New("refresh failed")
+	})
+	if err := s.Write(ctx, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	s.Read(ctx, "x") //nolint:errcheck
+	waitFor(t, func() bool { return calls.Load() == 1 })
+	for i := 0; i < 5; i++ {
+		if b, _ := s.Read(ctx, "x"); string(b) != "1" {
+			t.Fatalf("Read() = %q, want the stale value %q", b, "1")
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("refresher was called %d times before the retry delay, want 1", n)
+	}
+	time.Sleep(refreshRetryDelay)
+	s.Read(ctx, "x") //nolint:errcheck
+	waitFor(t, func() bool { return calls.Load() == 2 })
+}
+
+func TestManagerRefreshRecoversAfterStoreError(t *testing.T) {
+	store := newTestStore()
+	store.values["global::x"] = []byte("1")
+	mem := NewMemoryStore(nil, WithMemoryStoreTTL(20*time.Millisecond), WithMemoryStoreStaleWhileRevalidate(time.Hour))
+	defer mem.Close() //nolint:errcheck
+	m := New(mem, store)
+	read := func() int {
+		f := NewIntFlag("x")
+		if err := m.Read(context.Background(), &f); err != nil {
+			t.Fatal(err)
+		}
+		return f.Get()
+	}
+	read()
+	store.fail(errors.New("store is down"))
+	time.Sleep(30 * time.Millisecond)
+	if got := read(); got != 1 {
+		t.Fatalf("Read() = %d, want the stale value 1", got)
+	}
+	store.mu.Lock()
+	store.err = nil
+	store.values["global::x"] = []byte("2")
+	store.mu.Unlock()
+	time.Sleep(refreshRetryDelay)
+	waitFor(t, func() bool { return read() == 2 })
+}
+
+func waitFor(t *testing.T, fn func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		reads  map[string]int
+		victim string
+	}{
+		{"lru evicts the least recently read", EvictionLRU, map[string]int{"a": 1, "c": 1}, "b"},
+		{"lfu evicts the least frequently read", EvictionLFU, map[string]int{"a": 3, "b": 1, "c": 2}, "b"},
+		{"lfu evicts entries that were never read", EvictionLFU, map[string]int{"b": 1, "c": 1}, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewMemoryStore(nil, WithMemoryStoreMaxEntries(3), WithMemoryStoreEvictionPolicy(tt.policy))
+			defer s.Close() //nolint:errcheck
+			for _, k := range []string{"a", "b", "c"} {
+				if err := s.Write(ctx, k, []byte(k)); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(2 * time.Millisecond)
+			}
+			for _, k := range []string{"a", "b", "c"} {
+				for i := 0; i < tt.reads[k]; i++ {
+					s.Read(ctx, k) //nolint:errcheck
+				}
+				time.Sleep(2 * time.Millisecond)
+			}
+			if err := s.Write(ctx, "d", []byte("d")); err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range []string{"a", "b", "c", "d"} {
+				b, _ := s.Read(ctx, k)
+				if evicted := b == nil; evicted != (k == tt.victim) {
+					t.Errorf("entry %s evicted = %v, want %v", k, evicted, k == tt.victim)
+				}
+			}
+			if stats := s.Stats(); stats.Entries != 3 || stats.Evictions != 1 {
+				t.Errorf("Stats() = %+v, want 3 entries and 1 eviction", stats)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreEvictsExpiredEntriesFirst(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(nil, WithMemoryStoreMaxEntries(2), WithMemoryStoreNegativeTTL(time.Millisecond))
+	defer s.Close() //nolint:errcheck
+	if err := s.Write(ctx, "a", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(ctx, "b", tombstone); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	s.Read(ctx, "a") //nolint:errcheck
+	if err := s.Write(ctx, "c", []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := s.Read(ctx, "a"); string(b) != "a" {
+		t.Errorf("Read(a) = %q, want the live entry to survive", b)
+	}
+	if stats := s.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Stats() = %+v, want 2 entries and 1 eviction", stats)
+	}
+}
+
+func TestMemoryStoreSizeAccounting(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(nil)
+	defer s.Close() //nolint:errcheck
+	size := func(k, v string) int { return len(s.scopedKey(globalScope, k)) + len(v) }
+	steps := []struct {
+		name  string
+		key   string
+		value []byte
+		bytes int
+	}{
+		{"write", "a", []byte("111"), size("a", "111")},
+		{"overwrite", "a", []byte("1"), size("a", "1")},
+		{"second key", "bb", []byte("22"), size("a", "1") + size("bb", "22")},
+		{"delete", "a", nil, size("bb", "22")},
+	}
+	for _, step := range steps {
+		if err := s.Write(ctx, step.key, step.value); err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Stats().Bytes; got != step.bytes {
+			t.Errorf("%s: Stats().Bytes = %d, want %d", step.name, got, step.bytes)
+		}
+	}
+	s.mu.Lock()
+	s.flush()
+	s.mu.Unlock()
+	if stats := s.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats() = %+v after flush, want no entries or bytes", stats)
+	}
+}
+
+func TestMemoryStoreKeepsEntryLargerThanMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(nil, WithMemoryStoreMaxBytes(16))
+	defer s.Close() //nolint:errcheck
+	if err := s.Write(ctx, "a", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	big := []byte("a value that is larger than the limit")
+	if err := s.Write(ctx, "big", big); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := s.Read(ctx, "big"); string(b) != string(big) {
+		t.Errorf("Read(big) = %q, want the newest entry to be protected", b)
+	}
+	if b, _ := s.Read(ctx, "a"); b != nil {
+		t.Errorf("Read(a) = %q, want it to be evicted", b)
+	}
+	if stats := s.Stats(); stats.Entries != 1 || stats.Evictions != 1 {
+		t.Errorf("Stats() = %+v, want 1 entry and 1 eviction", stats)
+	}
+}
+
+type flakyInvalidator struct {
+	drop      chan struct{}
+	resumable bool
+}
+
+func newFlakyInvalidator(resumable bool) *flakyInvalidator {
+	return &flakyInvalidator{drop: make(chan struct{}), resumable: resumable}
+}
+
+func (i *flakyInvalidator) Publish(context.Context, Invalidation) error {
+	return nil
+}
+
+func (i *flakyInvalidator) Listen(ctx context.Context, ready func(), _ func(Invalidation)) error {
+	ready()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-i.drop:
+		return errors.New("subscription lost")
+	}
+}
+
+func (i *flakyInvalidator) Resumable() bool {
+	return i.resumable
+}
+
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []MemoryStoreState
+}
+
+func (r *stateRecorder) record(state MemoryStoreState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, state)
+}
+
+func (r *stateRecorder) get() []MemoryStoreState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.states)
+}
+
+func TestMemoryStoreDegradedMode(t *testing.T) {
+	ctx := context.Background()
+	inv := newFlakyInvalidator(false)
+	states := &stateRecorder{}
+	s := NewMemoryStore(nil,
+		WithMemoryStoreInvalidator(inv),
+		WithMemoryStoreDegradedTTL(200*time.Millisecond),
+		WithMemoryStoreStateChange(states.record),
+	)
+	waitFor(t, func() bool { return s.State() == MemoryStoreActive })
+	if err := s.Write(ctx, "before", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(120 * time.Millisecond)
+	inv.drop <- struct{}{}
+	waitFor(t, func() bool { return s.State() == MemoryStoreDisconnected })
+	time.Sleep(120 * time.Millisecond)
+	if b, _ := s.Read(ctx, "before"); string(b) != "1" {
+		t.Fatalf("Read(before) = %q, want the window to start from the disconnect", b)
+	}
+	if err := s.Write(ctx, "during", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.RLock()
+	v := s.values[s.scopedKey(globalScope, "during")]
+	s.mu.RUnlock()
+	if ttl := v.expires.Sub(v.created); ttl != 200*time.Millisecond {
+		t.Errorf("degraded write has a TTL of %v, want %v", ttl, 200*time.Millisecond)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if b, _ := s.Read(ctx, "before"); b != nil {
+		t.Errorf("Read(before) = %q, want nothing once the window since the disconnect has passed", b)
+	}
+	if b, _ := s.Read(ctx, "during"); string(b) != "2" {
+		t.Errorf("Read(during) = %q, want the window to start from the write", b)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if b, _ := s.Read(ctx, "during"); b != nil {
+		t.Errorf("Read(during) = %q, want nothing once its own window has passed", b)
+	}
+	if stats := s.Stats(); stats.Entries == 0 {
+		t.Fatal("expected entries to be kept while disconnected")
+	}
+	waitFor(t, func() bool { return s.State() == MemoryStoreActive })
+	if stats := s.Stats(); stats.Entries != 0 {
+		t.Errorf("Stats() = %+v after reconnecting, want the cache to be flushed", stats)
+	}
+	s.Close() //nolint:errcheck
+	want := []MemoryStoreState{MemoryStoreActive, MemoryStoreDisconnected, MemoryStoreActive, MemoryStoreClosed}
+	if got := states.get(); !slices.Equal(got, want) {
+		t.Errorf("state changes = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryStoreReconnect(t *testing.T) {
+	tests := []struct {
+		name            string
+		resumable       bool
+		degraded        time.Duration
+		disconnected    int
+		reconnected     int
+		servedWhileDown bool
+	}{
+		{"flushes on disconnect without degraded mode", false, 0, 0, 0, false},
+		{"flushes on reconnect in degraded mode", false, time.Minute, 1, 0, true},
+		{"keeps entries with a resumable invalidator", true, 0, 1, 1, false},
+		{"keeps entries with a resumable invalidator in degraded mode", true, time.Minute, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			inv := newFlakyInvalidator(tt.resumable)
+			s := NewMemoryStore(nil, WithMemoryStoreInvalidator(inv), WithMemoryStoreDegradedTTL(tt.degraded))
+			defer s.Close() //nolint:errcheck
+			waitFor(t, func() bool { return s.State() == MemoryStoreActive })
+			if err := s.Write(ctx, "x", []byte("1")); err != nil {
+				t.Fatal(err)
+			}
+			inv.drop <- struct{}{}
+			waitFor(t, func() bool { return s.State() == MemoryStoreDisconnected })
+			if got := s.Stats().Entries; got != tt.disconnected {
+				t.Errorf("%d entries while disconnected, want %d", got, tt.disconnected)
+			}
+			if b, _ := s.Read(ctx, "x"); (b != nil) != tt.servedWhileDown {
+				t.Errorf("Read() = %q while disconnected, want served %v", b, tt.servedWhileDown)
+			}
+			waitFor(t, func() bool { return s.State() == MemoryStoreActive })
+			if got := s.Stats().Entries; got != tt.reconnected {
+				t.Errorf("%d entries after reconnecting, want %d", got, tt.reconnected)
+			}
+		})
+	}
+}
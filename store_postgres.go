@@ -4,10 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sort"
 	"strings"
 	"sync"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var queryCreateSchema = `
@@ -35,17 +36,61 @@ create index if not exists :SCHEMA_flags_scope_key_value_idx
 on :SCHEMA.flags (scope, key, value)
 `
 
+var queryAddVersionColumn = `
+alter table :SCHEMA.flags
+add column if not exists version bigint not null default 0
+`
+
+var queryCreateHistoryTable = `
+create table if not exists :SCHEMA.flags_history (
+	id bigserial primary key,
+	created_at timestamptz not null default now(),
+	scope text not null,
+	key text not null,
+	version bigint not null,
+	old_value jsonb,
+	new_value jsonb,
+	actor text not null
+)
+`
+
+var queryCreateHistoryScopeKeyVersionIndex = `
+create unique index if not exists :SCHEMA_flags_history_scope_key_version_idx
+on :SCHEMA.flags_history (scope, key, version)
+`
+
 var queryReadFlag = `
 select value
 from :SCHEMA.flags
 where scope = $1 and key = $2
 `
 
+var queryReadFlagVersion = `
+select value, version
+from :SCHEMA.flags
+where scope = $1 and key = $2
+`
+
+var queryReadFlags = `
+select key, value
+from :SCHEMA.flags
+where scope = $1 and key = any($2)
+`
+
+var queryListFlags = `
+select key, value
+from :SCHEMA.flags
+where scope = $1 and key > $2
+order by scope, key
+limit $3
+`
+
 var queryUpsertFlag = `
-insert into :SCHEMA.flags (scope, key, value)
-values ($1, $2, $3)
+insert into :SCHEMA.flags (scope, key, value, version)
+values ($1, $2, $3, $4)
 on conflict (scope, key) do update set
 	value = $3,
+	version = $4,
 	updated_at = now()
 `
 
@@ -54,9 +99,33 @@ delete from :SCHEMA.flags
 where scope = $1 and key = $2
 `
 
+var queryLockFlag = `
+select pg_advisory_xact_lock(hashtext($1 || '::' || $2))
+`
+
+var queryNextHistoryVersion = `
+select coalesce(max(version), 0) + 1
+from :SCHEMA.flags_history
+where scope = $1 and key = $2
+`
+
+var queryInsertHistory = `
+insert into :SCHEMA.flags_history (scope, key, version, old_value, new_value, actor)
+values ($1, $2, $3, $4, $5, $6)
+`
+
+var queryReadHistory = `
+select version, created_at, old_value, new_value, actor
+from :SCHEMA.flags_history
+where scope = $1 and key = $2
+order by version
+`
+
 type PostgresStore struct {
-	client *sql.DB
-	schema string
+	client    *sql.DB
+	schema    string
+	channel   string
+	namespace string
 
 	migrateOnce sync.Once
 	migrateErr  error
@@ -70,6 +139,18 @@ func WithPostgresStoreSchema(schema string) postgresStoreOption {
 	}
 }
 
+func WithPostgresStoreNotifyChannel(channel string) postgresStoreOption {
+	return func(s *PostgresStore) {
+		s.channel = channel
+	}
+}
+
+func WithPostgresStoreNotifyNamespace(ns string) postgresStoreOption {
+	return func(s *PostgresStore) {
+		s.namespace = ns
+	}
+}
+
 func NewPostgresStore(client *sql.DB, opts ...postgresStoreOption) *PostgresStore {
 	s := &PostgresStore{client: client, schema: "public"}
 	for _, apply := range opts {
@@ -93,25 +174,230 @@ func (s *PostgresStore) Read(ctx context.Context, k string) ([]byte, error) {
 	return v, nil
 }
 
+func (s *PostgresStore) ReadMany(ctx context.Context, keys []string) ([][]byte, error) {
+	if err := s.migrate(ctx); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	rows, err := s.client.QueryContext(ctx, strings.ReplaceAll(queryReadFlags, ":SCHEMA", s.schema), s.scope(ctx, ""), pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+	found := make(map[string][]byte, len(keys))
+	for rows.Next() {
+		var (
+			k string
+			v []byte
+		)
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		found[k] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = found[k]
+	}
+	return values, nil
+}
+
+func (s *PostgresStore) List(ctx context.Context, cursor string, limit int) ([]Entry, string, error) {
+	if err := s.migrate(ctx); err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	scope := s.scope(ctx, "")
+	rows, err := s.client.QueryContext(ctx, strings.ReplaceAll(queryListFlags, ":SCHEMA", s.schema), scope, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close() //nolint:errcheck
+	entries := make([]Entry, 0, limit)
+	for rows.Next() {
+		entry := Entry{Scope: scope}
+		if err := rows.Scan(&entry.Key, &entry.Value); err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(entries) == limit {
+		next = entries[len(entries)-1].Key
+	}
+	return entries, next, nil
+}
+
 func (s *PostgresStore) Write(ctx context.Context, k string, v []byte) error {
 	if err := s.migrate(ctx); err != nil {
 		return err
 	}
-	scope := s.scope(ctx, k)
-	if v == nil {
-		_, err := s.client.ExecContext(ctx, strings.ReplaceAll(queryDeleteFlag, ":SCHEMA", s.schema), scope, k)
+	tx, err := s.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if _, err := s.write(ctx, tx, k, v, anyVersion); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) WriteMany(ctx context.Context, keys []string, values [][]byte) error {
+	if err := s.migrate(ctx); err != nil {
 		return err
 	}
-	_, err := s.client.ExecContext(ctx, strings.ReplaceAll(queryUpsertFlag, ":SCHEMA", s.schema), scope, k, v)
-	return err
+	tx, err := s.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	order := make([]int, len(keys))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return keys[order[i]] < keys[order[j]]
+	})
+	for _, idx := range order {
+		if _, err := s.write(ctx, tx, keys[idx], values[idx], anyVersion); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadVersion(ctx context.Context, k string) ([]byte, int64, error) {
+	if err := s.migrate(ctx); err != nil {
+		return nil, 0, err
+	}
+	var (
+		v       []byte
+		version int64
+	)
+	row := s.client.QueryRowContext(ctx, strings.ReplaceAll(queryReadFlagVersion, ":SCHEMA", s.schema), s.scope(ctx, k), k)
+	if err := row.Scan(&v, &version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	return v, version, nil
+}
+
+func (s *PostgresStore) WriteVersion(ctx context.Context, k string, v []byte, version int64) (int64, error) {
+	if err := s.migrate(ctx); err != nil {
+		return 0, err
+	}
+	tx, err := s.client.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	next, err := s.write(ctx, tx, k, v, version)
+	if err != nil {
+		return 0, err
+	}
+	return next, tx.Commit()
+}
+
+func (s *PostgresStore) History(ctx context.Context, k string) ([]HistoryEntry, error) {
+	if err := s.migrate(ctx); err != nil {
+		return nil, err
+	}
+	scope := s.scope(ctx, k)
+	rows, err := s.client.QueryContext(ctx, strings.ReplaceAll(queryReadHistory, ":SCHEMA", s.schema), scope, k)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+	var entries []HistoryEntry
+	for rows.Next() {
+		entry := HistoryEntry{Key: k, Scope: scope}
+		if err := rows.Scan(&entry.Version, &entry.CreatedAt, &entry.OldValue, &entry.NewValue, &entry.Actor); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
 }
 
 func (s *PostgresStore) Close() error {
 	return nil
 }
 
-func (s *PostgresStore) scope(_ context.Context, _ string) string {
-	return "global"
+func (s *PostgresStore) scope(ctx context.Context, _ string) string {
+	return ScopeFromContext(ctx)
+}
+
+func (s *PostgresStore) write(ctx context.Context, tx *sql.Tx, k string, v []byte, expected int64) (int64, error) {
+	scope := s.scope(ctx, k)
+	if _, err := tx.ExecContext(ctx, queryLockFlag, scope, k); err != nil {
+		return 0, err
+	}
+	var (
+		old     []byte
+		current int64
+	)
+	row := tx.QueryRowContext(ctx, strings.ReplaceAll(queryReadFlagVersion, ":SCHEMA", s.schema), scope, k)
+	if err := row.Scan(&old, &current); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if expected != anyVersion && expected != current {
+		return 0, &ConflictError{k, scope, expected, current}
+	}
+	if v == nil && old == nil {
+		return 0, nil
+	}
+	var next int64
+	row = tx.QueryRowContext(ctx, strings.ReplaceAll(queryNextHistoryVersion, ":SCHEMA", s.schema), scope, k)
+	if err := row.Scan(&next); err != nil {
+		return 0, err
+	}
+	if v == nil {
+		if _, err := tx.ExecContext(ctx, strings.ReplaceAll(queryDeleteFlag, ":SCHEMA", s.schema), scope, k); err != nil {
+			return 0, err
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx, strings.ReplaceAll(queryUpsertFlag, ":SCHEMA", s.schema), scope, k, v, next); err != nil {
+			return 0, err
+		}
+	}
+	_, err := tx.ExecContext(ctx, strings.ReplaceAll(queryInsertHistory, ":SCHEMA", s.schema),
+		scope, k, next, nullableBytes(old), nullableBytes(v), ActorFromContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	if s.channel != "" && !strings.Contains(scope, "::") {
+		hash := ""
+		if v != nil {
+			hash = hashValue(v)
+		}
+		payload, err := encodeInvalidation(Invalidation{Hash: hash, Namespace: s.namespace, Scope: scope, Key: k})
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, queryNotify, s.channel, payload); err != nil {
+			return 0, err
+		}
+	}
+	if v == nil {
+		return 0, nil
+	}
+	return next, nil
 }
 
 func (s *PostgresStore) migrate(ctx context.Context) error {
@@ -127,6 +413,9 @@ func (s *PostgresStore) migrate(ctx context.Context) error {
 			queryCreateTable,
 			queryCreateScopeKeyIndex,
 			queryCreateScopeKeyValueIndex,
+			queryAddVersionColumn,
+			queryCreateHistoryTable,
+			queryCreateHistoryScopeKeyVersionIndex,
 		}
 		for _, query := range queries {
 			_, err = tx.Exec(strings.ReplaceAll(query, ":SCHEMA", s.schema))
@@ -143,3 +432,10 @@ func (s *PostgresStore) migrate(ctx context.Context) error {
 	})
 	return s.migrateErr
 }
+
+func nullableBytes(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return b
+}
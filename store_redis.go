@@ -2,16 +2,43 @@ package tinyflags
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+var redisWriteScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[2]) or "0")
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	current = 0
+end
+local expected = tonumber(ARGV[3])
+if expected >= 0 and expected ~= current then
+	return {0, current}
+end
+if ARGV[4] == "1" then
+	redis.call("DEL", KEYS[1], KEYS[2])
+	return {1, 0}
+end
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+	redis.call("SET", KEYS[2], current + 1, "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+	redis.call("SET", KEYS[2], current + 1)
+end
+return {1, current + 1}
+`)
+
 type RedisStore struct {
 	client *redis.Client
 	ns     string
 	ttl    time.Duration
+	negTTL time.Duration
 }
 
 type redisStoreOption func(*RedisStore)
@@ -22,8 +49,14 @@ func WithRedisStoreTTL(ttl time.Duration) redisStoreOption {
 	}
 }
 
+func WithRedisStoreNegativeTTL(ttl time.Duration) redisStoreOption {
+	return func(s *RedisStore) {
+		s.negTTL = ttl
+	}
+}
+
 func NewRedisStore(client *redis.Client, ns string, opts ...redisStoreOption) *RedisStore {
-	s := &RedisStore{client, ns, 5 * time.Minute}
+	s := &RedisStore{client, ns, 5 * time.Minute, 1 * time.Minute}
 	for _, apply := range opts {
 		apply(s)
 	}
@@ -38,21 +71,143 @@ func (s *RedisStore) Read(ctx context.Context, k string) ([]byte, error) {
 	return v, err
 }
 
+func (s *RedisStore) ReadMany(ctx context.Context, keys []string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	redisKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		redisKeys = append(redisKeys, s.key(ctx, k))
+	}
+	res, err := s.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, v := range res {
+		if v, ok := v.(string); ok {
+			values[i] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func (s *RedisStore) List(ctx context.Context, cursor string, limit int) ([]Entry, string, error) {
+	var (
+		offset uint64
+		err    error
+	)
+	if cursor != "" {
+		if offset, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q: %w", cursor, err)
+		}
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	scope, prefix := s.scope(ctx, ""), s.key(ctx, "")
+	redisKeys, offset, err := s.client.Scan(ctx, offset, escapeGlob(prefix)+"*", int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if offset != 0 {
+		next = strconv.FormatUint(offset, 10)
+	}
+	if len(redisKeys) == 0 {
+		return nil, next, nil
+	}
+	values, err := s.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	entries := make([]Entry, 0, len(redisKeys))
+	for i, redisKey := range redisKeys {
+		if v, ok := values[i].(string); ok && !IsTombstone([]byte(v)) {
+			entries = append(entries, Entry{strings.TrimPrefix(redisKey, prefix), scope, []byte(v)})
+		}
+	}
+	return entries, next, nil
+}
+
 func (s *RedisStore) Write(ctx context.Context, k string, v []byte) error {
-	if v == nil {
-		return s.client.Del(ctx, s.key(ctx, k)).Err()
+	_, err := s.write(ctx, k, v, anyVersion)
+	return err
+}
+
+func (s *RedisStore) ReadVersion(ctx context.Context, k string) ([]byte, int64, error) {
+	res, err := s.client.MGet(ctx, s.key(ctx, k), s.versionKey(ctx, k)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	v, ok := res[0].(string)
+	if !ok || IsTombstone([]byte(v)) {
+		return nil, 0, nil
 	}
-	return s.client.Set(ctx, s.key(ctx, k), v, s.ttl).Err()
+	var version int64
+	if raw, ok := res[1].(string); ok {
+		if version, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, 0, err
+		}
+	}
+	return []byte(v), version, nil
+}
+
+func (s *RedisStore) WriteVersion(ctx context.Context, k string, v []byte, version int64) (int64, error) {
+	return s.write(ctx, k, v, version)
 }
 
 func (s *RedisStore) Close() error {
 	return nil
 }
 
-func (s *RedisStore) scope(_ context.Context, _ string) string {
-	return "global"
+func (s *RedisStore) scope(ctx context.Context, _ string) string {
+	return ScopeFromContext(ctx)
 }
 
 func (s *RedisStore) key(ctx context.Context, k string) string {
 	return strings.Join([]string{"tinyflags", "redisStore", s.ns, s.scope(ctx, k), k}, "::")
 }
+
+func (s *RedisStore) versionKey(ctx context.Context, k string) string {
+	return strings.Join([]string{"tinyflags", "redisStoreVersions", s.ns, s.scope(ctx, k), k}, "::")
+}
+
+func (s *RedisStore) write(ctx context.Context, k string, v []byte, expected int64) (int64, error) {
+	if IsTombstone(v) {
+		if s.negTTL <= 0 {
+			return 0, nil
+		}
+		_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.key(ctx, k), v, s.negTTL)
+			pipe.Del(ctx, s.versionKey(ctx, k))
+			return nil
+		})
+		return 0, err
+	}
+	del := "0"
+	if v == nil {
+		del = "1"
+	}
+	keys := []string{s.key(ctx, k), s.versionKey(ctx, k)}
+	res, err := redisWriteScript.Run(ctx, s.client, keys, v, s.ttl.Milliseconds(), expected, del).Int64Slice()
+	if err != nil {
+		return 0, err
+	}
+	if res[0] == 0 {
+		return 0, &ConflictError{k, s.scope(ctx, k), expected, res[1]}
+	}
+	return res[1], nil
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package tinyflags
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type testStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	reads  atomic.Int64
+	delay  time.Duration
+	err    error
+}
+
+func newTestStore() *testStore {
+	return &testStore{values: make(map[string][]byte)}
+}
+
+func (s *testStore) Read(ctx context.Context, k string) ([]byte, error) {
+	s.reads.Add(1)
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.values[ScopeFromContext(ctx)+"::"+k], nil
+}
+
+func (s *testStore) Write(ctx context.Context, k string, v []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if v == nil {
+		delete(s.values, ScopeFromContext(ctx)+"::"+k)
+		return nil
+	}
+	s.values[ScopeFromContext(ctx)+"::"+k] = v
+	return nil
+}
+
+func (s *testStore) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *testStore) Close() error {
+	return nil
+}
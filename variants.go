@@ -0,0 +1,72 @@
+package tinyflags
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type Variant[V any] struct {
+	Name   string
+	Weight int
+	Value  V
+}
+
+func NewVariant[V any](name string, weight int, value V) Variant[V] {
+	return Variant[V]{name, weight, value}
+}
+
+type Variants[V any] []Variant[V]
+
+func NewVariants[V any](variants ...Variant[V]) Variants[V] {
+	return variants
+}
+
+func (v Variants[V]) MarshalJSON() ([]byte, error) {
+	d := &variantsDirective{Variants: make([]variantDirective, 0, len(v))}
+	for _, variant := range v {
+		value, err := json.Marshal(variant.Value)
+		if err != nil {
+			return nil, err
+		}
+		d.Variants = append(d.Variants, variantDirective{variant.Name, variant.Weight, value})
+	}
+	return json.Marshal(directive{Variants: d})
+}
+
+type variantDirective struct {
+	Name   string          `json:"name"`
+	Weight int             `json:"weight"`
+	Value  json.RawMessage `json:"value"`
+}
+
+type variantsDirective struct {
+	Variants []variantDirective `json:"variants"`
+}
+
+func (d *variantsDirective) evaluate(ctx context.Context, k string) (json.RawMessage, string) {
+	if len(d.Variants) == 0 {
+		return nil, ""
+	}
+	subject := SubjectFromContext(ctx)
+	total := 0
+	for _, variant := range d.Variants {
+		if variant.Weight > 0 {
+			total += variant.Weight
+		}
+	}
+	if subject == "" || total == 0 {
+		return d.Variants[0].Value, d.Variants[0].Name
+	}
+	position := bucket(k+"\x00variants", subject) / 100 * float64(total)
+	for _, variant := range d.Variants {
+		if variant.Weight <= 0 {
+			continue
+		}
+		if position < float64(variant.Weight) {
+			return variant.Value, variant.Name
+		}
+		position -= float64(variant.Weight)
+	}
+	last := d.Variants[len(d.Variants)-1]
+	return last.Value, last.Name
+}
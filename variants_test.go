@@ -0,0 +1,85 @@
+package tinyflags
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestVariantsDistribution(t *testing.T) {
+	b, err := json.Marshal(NewVariants(
+		NewVariant("control", 50, "control"),
+		NewVariant("blue", 25, "blue"),
+		NewVariant("green", 25, "green"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := resolveMany(t, b, 10000)
+	assertShare(t, counts, "control", 10000, 0.50)
+	assertShare(t, counts, "blue", 10000, 0.25)
+	assertShare(t, counts, "green", 10000, 0.25)
+}
+
+func TestRolloutWithVariantsDistribution(t *testing.T) {
+	variants, err := json.Marshal(NewVariants(
+		NewVariant("a", 50, "a"),
+		NewVariant("b", 50, "b"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(NewRollout(50, json.RawMessage(variants), json.RawMessage(`"off"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := resolveMany(t, b, 10000)
+	assertShare(t, counts, "off", 10000, 0.50)
+	assertShare(t, counts, "a", 10000, 0.25)
+	assertShare(t, counts, "b", 10000, 0.25)
+}
+
+func TestVariantsSticky(t *testing.T) {
+	b, err := json.Marshal(NewVariants(NewVariant("a", 1, "a"), NewVariant("b", 1, "b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithSubject(context.Background(), "user:42")
+	first, _, err := resolve(ctx, "k", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		got, _, _ := resolve(ctx, "k", b)
+		if string(got) != string(first) {
+			t.Fatalf("resolve() = %s, want %s", got, first)
+		}
+	}
+}
+
+func resolveMany(t *testing.T, b []byte, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		ctx := WithSubject(context.Background(), "user:"+strconv.Itoa(i))
+		got, _, err := resolve(ctx, "experiment", b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v string
+		if err := json.Unmarshal(got, &v); err != nil {
+			t.Fatal(err)
+		}
+		counts[v]++
+	}
+	return counts
+}
+
+func assertShare(t *testing.T, counts map[string]int, name string, n int, want float64) {
+	t.Helper()
+	if got := float64(counts[name]) / float64(n); math.Abs(got-want) > 0.03 {
+		t.Errorf("share of %q = %.3f, want %.3f (counts %v)", name, got, want, counts)
+	}
+}
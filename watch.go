@@ -0,0 +1,159 @@
+package tinyflags
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+type WatchableStore interface {
+	Store
+	Watch(ctx context.Context, fn func(ctx context.Context, k string)) error
+}
+
+type Change struct {
+	Key   string
+	Scope string
+	Value []byte
+}
+
+func (c Change) Decode(ctx context.Context, flag any) error {
+	f, err := toFlagger(flag)
+	if err != nil {
+		return err
+	}
+	if c.Value == nil {
+		f.miss()
+		return nil
+	}
+	if err := f.absorb(ctx, c.Value); err != nil {
+		return &DecodeError{Key: c.Key, Scope: c.Scope, Index: -1, Err: err}
+	}
+	return nil
+}
+
+type watchEvent struct {
+	key   string
+	scope string
+	value []byte
+	read  bool
+}
+
+type watcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	keys    map[string]bool
+	mu      sync.Mutex
+	pending []watchEvent
+	wake    chan struct{}
+	ch      chan Change
+}
+
+func (w *watcher) push(e watchEvent) {
+	w.mu.Lock()
+	for i, p := range w.pending {
+		if p.key == e.key && p.scope == e.scope {
+			w.pending = append(w.pending[:i], w.pending[i+1:]...)
+			break
+		}
+	}
+	w.pending = append(w.pending, e)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) pop() (watchEvent, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) == 0 {
+		return watchEvent{}, false
+	}
+	e := w.pending[0]
+	w.pending = w.pending[1:]
+	return e, true
+}
+
+func (w *watcher) run(m *Manager) {
+	defer close(w.ch)
+	type sentKey struct{ scope, key string }
+	sent := make(map[sentKey][]byte)
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-w.wake:
+		}
+		for e, ok := w.pop(); ok; e, ok = w.pop() {
+			if e.read {
+				b, err := m.readScoped(WithScope(context.Background(), e.scope), e.key)
+				if err != nil {
+					logger.Errorf(w.ctx, "failed to read changed flag %s: %v", e.key, err)
+					continue
+				}
+				e.value = b
+			}
+			if last, ok := sent[sentKey{e.scope, e.key}]; ok && bytes.Equal(last, e.value) {
+				continue
+			}
+			sent[sentKey{e.scope, e.key}] = e.value
+			select {
+			case w.ch <- Change{e.key, e.scope, e.value}:
+			case <-w.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (m *Manager) Watch(ctx context.Context, keys ...string) (<-chan Change, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{
+		ctx:    ctx,
+		cancel: cancel,
+		keys:   make(map[string]bool, len(keys)),
+		wake:   make(chan struct{}, 1),
+		ch:     make(chan Change, 16),
+	}
+	for _, k := range keys {
+		w.keys[k] = true
+	}
+	m.mu.Lock()
+	m.watchers[w] = struct{}{}
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.watchers, w)
+		m.mu.Unlock()
+	}()
+	go w.run(m)
+	for _, store := range m.stores {
+		store, ok := store.(WatchableStore)
+		if !ok {
+			continue
+		}
+		err := store.Watch(ctx, func(scopeCtx context.Context, k string) {
+			if w.keys[k] {
+				w.push(watchEvent{key: k, scope: ScopeFromContext(scopeCtx), read: true})
+			}
+		})
+		if err != nil {
+			w.cancel()
+			return nil, err
+		}
+	}
+	return w.ch, nil
+}
+
+func (m *Manager) notify(ctx context.Context, k string, v []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for w := range m.watchers {
+		if w.keys[k] {
+			w.push(watchEvent{key: k, scope: ScopeFromContext(ctx), value: v})
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package tinyflags
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchDeliversLatestValue(t *testing.T) {
+	m := New(newTestStore())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := m.Watch(ctx, "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 200; i++ {
+		f := NewIntFlag("counter").With(i)
+		if err := m.Write(context.Background(), &f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := NewIntFlag("counter")
+	last := 0
+	timeout := time.After(2 * time.Second)
+	for last != 200 {
+		select {
+		case c := <-changes:
+			if err := c.Decode(context.Background(), &f); err != nil {
+				t.Fatal(err)
+			}
+			if f.Get() <= last {
+				t.Fatalf("received %d after %d", f.Get(), last)
+			}
+			last = f.Get()
+		case <-timeout:
+			t.Fatalf("last received value = %d, want 200", last)
+		}
+	}
+}
+
+func TestWatchClosesChannel(t *testing.T) {
+	m := New(newTestStore())
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := m.Watch(ctx, "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatal("expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed")
+	}
+}
+
+func TestWatchIgnoresCacheFills(t *testing.T) {
+	store := newTestStore()
+	store.values["global::x"] = []byte("1")
+	inv := NewLocalInvalidator()
+	a := New(NewMemoryStore(nil, WithMemoryStoreInvalidator(inv)), store)
+	b := New(NewMemoryStore(nil, WithMemoryStoreInvalidator(inv)), store)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := a.Watch(ctx, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewIntFlag("x")
+	if err := b.Read(context.Background(), &f); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-changes:
+		t.Fatalf("received %+v for a cache fill", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+	f = NewIntFlag("x").With(2)
+	if err := b.Write(context.Background(), &f); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-changes:
+		if string(c.Value) != "2" {
+			t.Fatalf("received %q, want %q", c.Value, "2")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change received for a write")
+	}
+	select {
+	case c := <-changes:
+		t.Fatalf("received a duplicate change %+v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchDropsUnchangedValues(t *testing.T) {
+	m := New(newTestStore())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := m.Watch(ctx, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []int{1, 1, 2} {
+		f := NewIntFlag("x").With(v)
+		if err := m.Write(context.Background(), &f); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, want := range []string{"1", "2"} {
+		select {
+		case c := <-changes:
+			if string(c.Value) != want {
+				t.Fatalf("received %q, want %q", c.Value, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no change received, want %q", want)
+		}
+	}
+	select {
+	case c := <-changes:
+		t.Fatalf("received an unexpected change %+v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}